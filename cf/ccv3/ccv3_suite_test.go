@@ -0,0 +1,13 @@
+package ccv3_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCCV3(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CCV3 Suite")
+}
@@ -0,0 +1,294 @@
+// Package ccv3 is a minimal client for the Cloud Controller v3 API, covering
+// what the smoke tests need without shelling out to the cf CLI.
+package ccv3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client talks to a Cloud Controller and the UAA it delegates to
+type Client struct {
+	api  string
+	http *http.Client
+
+	lock      sync.Mutex
+	grant     url.Values
+	grantUser string
+	grantPass string
+	token     string
+	expiresAt time.Time
+	orgGUID   string
+	spaceGUID string
+
+	poll time.Duration
+	now  func() time.Time
+}
+
+// NewClient returns a Client for the Cloud Controller at api, which may omit its scheme
+func NewClient(api string, skipSSLValidation bool) *Client {
+	if !strings.Contains(api, "://") {
+		api = "https://" + api
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: skipSSLValidation}
+
+	return &Client{
+		api:  strings.TrimRight(api, "/"),
+		http: &http.Client{Transport: transport},
+		poll: time.Second,
+		now:  time.Now,
+	}
+}
+
+// WithPollInterval sets how often asynchronous jobs, packages and builds are polled
+func (c *Client) WithPollInterval(interval time.Duration) *Client {
+	c.poll = interval
+	return c
+}
+
+// APIError is a non-2xx response from the Cloud Controller or UAA
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Errors     []struct {
+		Code   int    `json:"code"`
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+	Body string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	details := make([]string, 0, len(e.Errors))
+	for _, apiErr := range e.Errors {
+		details = append(details, fmt.Sprintf("%s: %s", apiErr.Title, apiErr.Detail))
+	}
+	if len(details) == 0 && e.Body != "" {
+		details = append(details, e.Body)
+	}
+
+	return fmt.Sprintf("%s %s returned %d: %s", e.Method, e.URL, e.StatusCode, strings.Join(details, "; "))
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *APIError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// NotFoundError is returned when a resource looked up by name does not exist
+type NotFoundError struct {
+	Resource string
+	Name     string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s '%s' not found", e.Resource, e.Name)
+}
+
+// Info checks that the Cloud Controller is reachable and returns its UAA URL
+func (c *Client) Info(ctx context.Context) (string, error) {
+	var root struct {
+		Links struct {
+			UAA   struct{ Href string } `json:"uaa"`
+			Login struct{ Href string } `json:"login"`
+		} `json:"links"`
+	}
+
+	// the root endpoint is unauthenticated, and is used while fetching a token
+	req, err := http.NewRequest(http.MethodGet, c.api+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if _, err := c.roundTrip(req.WithContext(ctx), &root); err != nil {
+		return "", err
+	}
+
+	if root.Links.UAA.Href != "" {
+		return root.Links.UAA.Href, nil
+	}
+	return root.Links.Login.Href, nil
+}
+
+// Login authenticates as a user with the password grant
+func (c *Client) Login(ctx context.Context, user, password string) error {
+	grant := url.Values{
+		"grant_type": {"password"},
+		"username":   {user},
+		"password":   {password},
+	}
+	return c.authenticate(ctx, grant, "cf", "")
+}
+
+// LoginClient authenticates as a UAA client with the client credentials grant
+func (c *Client) LoginClient(ctx context.Context, client, secret string) error {
+	grant := url.Values{"grant_type": {"client_credentials"}}
+	return c.authenticate(ctx, grant, client, secret)
+}
+
+func (c *Client) authenticate(ctx context.Context, grant url.Values, user, password string) error {
+	c.lock.Lock()
+	c.grant, c.grantUser, c.grantPass = grant, user, password
+	c.token = ""
+	c.lock.Unlock()
+
+	_, err := c.accessToken(ctx)
+	return err
+}
+
+// accessToken returns a bearer token, requesting a new one from the UAA when
+// the current one is missing or about to expire
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.grant == nil {
+		return "", nil
+	}
+
+	if c.token != "" && c.now().Add(30*time.Second).Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	uaa, err := c.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(uaa, "/")+"/oauth/token", strings.NewReader(c.grant.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.grantUser, c.grantPass)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if _, err := c.roundTrip(req.WithContext(ctx), &token); err != nil {
+		return "", err
+	}
+
+	c.token = token.AccessToken
+	c.expiresAt = c.now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+func (c *Client) invalidateToken() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.token = ""
+}
+
+// Target records the org and space that names are resolved in
+func (c *Client) Target(orgGUID, spaceGUID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.orgGUID, c.spaceGUID = orgGUID, spaceGUID
+}
+
+// Targeted returns the org and space recorded by Target
+func (c *Client) Targeted() (orgGUID, spaceGUID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.orgGUID, c.spaceGUID
+}
+
+// do sends a JSON request to a Cloud Controller path, decoding the response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	return c.send(ctx, method, c.api+path, body, "application/json", out)
+}
+
+func (c *Client) send(ctx context.Context, method, target string, body io.Reader, contentType string, out interface{}) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = ioutil.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+
+	for retried := false; ; retried = true {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(method, target, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "bearer "+token)
+		}
+
+		header, err := c.roundTrip(req.WithContext(ctx), out)
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusUnauthorized && token != "" && !retried {
+			// the token may have been revoked or expired early
+			c.invalidateToken()
+			continue
+		}
+		return header, err
+	}
+}
+
+func (c *Client) roundTrip(req *http.Request, out interface{}) (http.Header, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+		}
+		json.Unmarshal(body, apiErr)
+		return resp.Header, apiErr
+	}
+
+	if out != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil {
+			return resp.Header, fmt.Errorf("decoding response from %s %s: %s", req.Method, req.URL, err)
+		}
+	}
+
+	return resp.Header, nil
+}
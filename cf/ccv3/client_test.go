@@ -0,0 +1,304 @@
+package ccv3_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+)
+
+// fakeCC serves a Cloud Controller and UAA from one server
+type fakeCC struct {
+	lock     sync.Mutex
+	server   *httptest.Server
+	tokens   int
+	requests []*http.Request
+	handlers map[string]http.HandlerFunc
+}
+
+func newFakeCC() *fakeCC {
+	fake := &fakeCC{handlers: map[string]http.HandlerFunc{}}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	return fake
+}
+
+func (f *fakeCC) handle(pattern string, handler http.HandlerFunc) {
+	f.handlers[pattern] = handler
+}
+
+func (f *fakeCC) serve(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	f.requests = append(f.requests, r)
+	f.lock.Unlock()
+
+	switch r.URL.Path {
+	case "/":
+		fmt.Fprintf(w, `{"links": {"uaa": {"href": "%s/uaa"}}}`, f.server.URL)
+		return
+	case "/uaa/oauth/token":
+		f.lock.Lock()
+		f.tokens++
+		token := f.tokens
+		f.lock.Unlock()
+
+		r.ParseForm()
+		user, _, _ := r.BasicAuth()
+		if r.Form.Get("password") == "wrong" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "unauthorized", "error_description": "Bad credentials"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "token-%d-%s", "expires_in": 3600}`, token, user)
+		return
+	}
+
+	handler, ok := f.handlers[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors": [{"code": 10000, "title": "CF-NotFound", "detail": "Unknown request"}]}`)
+		return
+	}
+	handler(w, r)
+}
+
+var _ = Describe("Client", func() {
+	var (
+		fake   *fakeCC
+		client *ccv3.Client
+		ctx    = context.Background()
+	)
+
+	BeforeEach(func() {
+		fake = newFakeCC()
+		client = ccv3.NewClient(fake.server.URL, false).WithPollInterval(time.Millisecond)
+	})
+
+	AfterEach(func() {
+		fake.server.Close()
+	})
+
+	Describe("authentication", func() {
+		It("discovers the UAA and sends the token it grants", func() {
+			var authorization string
+			fake.handle("GET /v3/organizations", func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				fmt.Fprint(w, `{"resources": [{"guid": "org-guid", "name": "my-org"}]}`)
+			})
+
+			Expect(client.Login(ctx, "admin", "secret")).To(Succeed())
+			org, err := client.OrganizationByName(ctx, "my-org")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(org.GUID).To(Equal("org-guid"))
+			Expect(authorization).To(Equal("bearer token-1-cf"))
+		})
+
+		It("uses the client credentials for client logins", func() {
+			Expect(client.LoginClient(ctx, "smoke-tests", "secret")).To(Succeed())
+
+			var authorization string
+			fake.handle("GET /v3/apps", func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				fmt.Fprint(w, `{"resources": [{"guid": "app-guid"}]}`)
+			})
+			client.AppByName(ctx, "space-guid", "app")
+
+			Expect(authorization).To(Equal("bearer token-1-smoke-tests"))
+		})
+
+		It("fetches a new token once when the Cloud Controller rejects the current one", func() {
+			Expect(client.Login(ctx, "admin", "secret")).To(Succeed())
+
+			calls := 0
+			fake.handle("GET /v3/spaces", func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.Header.Get("Authorization") == "bearer token-1-cf" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `{"resources": [{"guid": "space-guid"}]}`)
+			})
+
+			space, err := client.SpaceByName(ctx, "org-guid", "space")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(space.GUID).To(Equal("space-guid"))
+			Expect(calls).To(Equal(2))
+		})
+
+		It("returns a non-temporary error for bad credentials", func() {
+			err := client.Login(ctx, "admin", "wrong")
+
+			var apiErr *ccv3.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(apiErr.Temporary()).To(BeFalse())
+		})
+	})
+
+	Describe("errors", func() {
+		It("decodes Cloud Controller errors", func() {
+			fake.handle("POST /v3/service_instances", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"errors": [{"code": 10008, "title": "CF-UnprocessableEntity", "detail": "plan instance limit exceeded for service"}]}`)
+			})
+
+			err := client.CreateServiceInstance(ctx, "space-guid", "plan-guid", "instance")
+
+			var apiErr *ccv3.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.Temporary()).To(BeFalse())
+			Expect(err.Error()).To(ContainSubstring("plan instance limit exceeded for service"))
+		})
+
+		It("treats server errors as temporary", func() {
+			fake.handle("GET /v3/domains", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			})
+
+			_, err := client.DomainByName(ctx, "example.com")
+			Expect(err.(*ccv3.APIError).Temporary()).To(BeTrue())
+		})
+
+		It("returns a NotFoundError when no resource has the name", func() {
+			fake.handle("GET /v3/service_plans", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Query().Get("names")).To(Equal("cache-small"))
+				Expect(r.URL.Query().Get("service_offering_names")).To(Equal("p.redis"))
+				fmt.Fprint(w, `{"resources": []}`)
+			})
+
+			_, err := client.ServicePlanByName(ctx, "p.redis", "cache-small")
+
+			var notFound *ccv3.NotFoundError
+			Expect(errors.As(err, &notFound)).To(BeTrue())
+			Expect(err.Error()).To(Equal("Service plan 'cache-small' not found"))
+		})
+	})
+
+	Describe("service instances", func() {
+		It("reads the last operation", func() {
+			fake.handle("GET /v3/service_instances", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"resources": [{"guid": "si-guid", "name": "redis", "last_operation": {"type": "create", "state": "in progress", "description": "Instance provisioning in progress"}}]}`)
+			})
+
+			instance, err := client.ServiceInstanceByName(ctx, "space-guid", "redis")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instance.LastOperation).To(Equal(ccv3.LastOperation{
+				Type:        "create",
+				State:       "in progress",
+				Description: "Instance provisioning in progress",
+			}))
+		})
+
+		It("only sends the fields being updated", func() {
+			var body []byte
+			fake.handle("PATCH /v3/service_instances/si-guid", func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusAccepted)
+			})
+
+			err := client.UpdateServiceInstance(ctx, "si-guid", ccv3.ServiceInstanceUpdate{
+				Parameters: json.RawMessage(`{"maxmemory-policy": "allkeys-lru"}`),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(`{"parameters": {"maxmemory-policy": "allkeys-lru"}}`))
+
+			err = client.UpdateServiceInstance(ctx, "si-guid", ccv3.ServiceInstanceUpdate{PlanGUID: "plan-guid"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(`{"relationships": {"service_plan": {"data": {"guid": "plan-guid"}}}}`))
+		})
+
+		It("returns the raw credentials of a binding", func() {
+			fake.handle("GET /v3/service_credential_bindings/key-guid/details", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"credentials": {"host": "10.0.0.1", "port": 6379}}`)
+			})
+
+			details, err := client.CredentialBindingDetails(ctx, "key-guid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(details).To(MatchJSON(`{"host": "10.0.0.1", "port": 6379}`))
+		})
+	})
+
+	Describe("jobs", func() {
+		var polls int
+
+		BeforeEach(func() {
+			polls = 0
+			fake.handle("POST /v3/service_credential_bindings", func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body["type"]).To(Equal("key"))
+
+				w.Header().Set("Location", fake.server.URL+"/v3/jobs/job-guid")
+				w.WriteHeader(http.StatusAccepted)
+			})
+		})
+
+		It("waits for asynchronous jobs to complete", func() {
+			fake.handle("GET /v3/jobs/job-guid", func(w http.ResponseWriter, r *http.Request) {
+				polls++
+				if polls < 3 {
+					fmt.Fprint(w, `{"state": "PROCESSING"}`)
+					return
+				}
+				fmt.Fprint(w, `{"state": "COMPLETE"}`)
+			})
+
+			Expect(client.CreateServiceKey(ctx, "si-guid", "key")).To(Succeed())
+			Expect(polls).To(Equal(3))
+		})
+
+		It("returns the errors of failed jobs", func() {
+			fake.handle("GET /v3/jobs/job-guid", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"operation": "service_bindings.create", "state": "FAILED", "errors": [{"detail": "broker said no"}]}`)
+			})
+
+			err := client.CreateServiceKey(ctx, "si-guid", "key")
+
+			var jobErr *ccv3.JobError
+			Expect(errors.As(err, &jobErr)).To(BeTrue())
+			Expect(jobErr.Errors).To(ConsistOf("broker said no"))
+		})
+	})
+
+	Describe("ParsePushArgs", func() {
+		It("reads the push flags used by the smoke tests", func() {
+			opts, err := ccv3.ParsePushArgs([]string{
+				"-m", "256M",
+				"-p", "../assets/app",
+				"-d", "example.com",
+				"-b", "ruby_buildpack",
+				"--no-start",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(opts).To(Equal(ccv3.PushOptions{
+				Path:       "../assets/app",
+				MemoryInMB: 256,
+				Domain:     "example.com",
+				Buildpacks: []string{"ruby_buildpack"},
+				NoStart:    true,
+			}))
+		})
+
+		It("converts gigabytes", func() {
+			opts, err := ccv3.ParsePushArgs([]string{"-m", "1G"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(opts.MemoryInMB).To(Equal(1024))
+		})
+
+		It("rejects flags it does not understand", func() {
+			_, err := ccv3.ParsePushArgs([]string{"--strategy", "rolling"})
+			Expect(err).To(MatchError("unsupported push flag --strategy"))
+		})
+	})
+})
@@ -0,0 +1,286 @@
+package ccv3
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PushOptions are the cf push flags the smoke tests rely on
+type PushOptions struct {
+	Path       string
+	MemoryInMB int
+	Domain     string
+	Buildpacks []string
+	NoStart    bool
+}
+
+// Push creates or updates the app from the directory at opts.Path, stages it,
+// routes name.domain to it and, unless opts.NoStart is set, starts it
+func (c *Client) Push(ctx context.Context, spaceGUID, name string, opts PushOptions) (App, error) {
+	app, err := c.AppByName(ctx, spaceGUID, name)
+	if _, notFound := err.(*NotFoundError); notFound {
+		app, err = c.CreateApp(ctx, spaceGUID, name, opts.Buildpacks)
+	}
+	if err != nil {
+		return app, err
+	}
+
+	packageGUID, err := c.uploadPackage(ctx, app.GUID, opts.Path)
+	if err != nil {
+		return app, err
+	}
+
+	dropletGUID, err := c.stage(ctx, packageGUID, opts.Buildpacks)
+	if err != nil {
+		return app, err
+	}
+
+	body := map[string]interface{}{"data": map[string]string{"guid": dropletGUID}}
+	if _, err := c.do(ctx, http.MethodPatch, "/v3/apps/"+app.GUID+"/relationships/current_droplet", body, nil); err != nil {
+		return app, err
+	}
+
+	if opts.MemoryInMB > 0 {
+		if err := c.ScaleApp(ctx, app.GUID, opts.MemoryInMB); err != nil {
+			return app, err
+		}
+	}
+
+	if opts.Domain != "" {
+		domain, err := c.DomainByName(ctx, opts.Domain)
+		if err != nil {
+			return app, err
+		}
+		if err := c.MapRoute(ctx, spaceGUID, domain.GUID, name, app.GUID); err != nil {
+			return app, err
+		}
+	}
+
+	if opts.NoStart {
+		return app, nil
+	}
+	return app, c.StartApp(ctx, app.GUID)
+}
+
+func (c *Client) uploadPackage(ctx context.Context, appGUID, path string) (string, error) {
+	body := map[string]interface{}{
+		"type": "bits",
+		"relationships": map[string]interface{}{
+			"app": relationTo(appGUID),
+		},
+	}
+
+	var pkg struct {
+		GUID string `json:"guid"`
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/v3/packages", body, &pkg); err != nil {
+		return "", err
+	}
+
+	upload, contentType, err := bitsUpload(path)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := c.send(ctx, http.MethodPost, c.api+"/v3/packages/"+pkg.GUID+"/upload", upload, contentType, nil); err != nil {
+		return "", err
+	}
+
+	return pkg.GUID, c.awaitState(ctx, "/v3/packages/"+pkg.GUID, "READY", nil)
+}
+
+func (c *Client) stage(ctx context.Context, packageGUID string, buildpacks []string) (string, error) {
+	body := map[string]interface{}{
+		"package": map[string]string{"guid": packageGUID},
+	}
+	if len(buildpacks) > 0 {
+		body["lifecycle"] = map[string]interface{}{
+			"type": "buildpack",
+			"data": map[string]interface{}{"buildpacks": buildpacks},
+		}
+	}
+
+	var build struct {
+		GUID string `json:"guid"`
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/v3/builds", body, &build); err != nil {
+		return "", err
+	}
+
+	var staged struct {
+		Droplet struct {
+			GUID string `json:"guid"`
+		} `json:"droplet"`
+	}
+	err := c.awaitState(ctx, "/v3/builds/"+build.GUID, "STAGED", &staged)
+	return staged.Droplet.GUID, err
+}
+
+// awaitState polls a package or build until it reaches state, decoding the
+// final resource into out
+func (c *Client) awaitState(ctx context.Context, path, state string, out interface{}) error {
+	for {
+		var resource struct {
+			State string `json:"state"`
+			Error string `json:"error"`
+		}
+		if _, err := c.do(ctx, http.MethodGet, path, nil, &resource); err != nil {
+			return err
+		}
+
+		switch resource.State {
+		case state:
+			if out == nil {
+				return nil
+			}
+			_, err := c.do(ctx, http.MethodGet, path, nil, out)
+			return err
+		case "FAILED", "EXPIRED":
+			return fmt.Errorf("%s is %s: %s", path, resource.State, resource.Error)
+		}
+
+		if err := pause(ctx, c.poll); err != nil {
+			return err
+		}
+	}
+}
+
+// bitsUpload zips the directory at path into a multipart body for the package upload endpoint
+func bitsUpload(path string) (io.Reader, string, error) {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+
+	part, err := form.CreateFormFile("bits", "app.zip")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := zipDirectory(part, path); err != nil {
+		return nil, "", err
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body, form.FormDataContentType(), nil
+}
+
+func zipDirectory(w io.Writer, root string) error {
+	archive := zip.NewWriter(w)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil || relative == "." {
+			return err
+		}
+
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relative)
+
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = archive.CreateHeader(header)
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header.Method = zip.Deflate
+		entry, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(entry, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// ParsePushArgs reads the subset of cf push flags understood by Push
+func ParsePushArgs(args []string) (PushOptions, error) {
+	var opts PushOptions
+
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+
+		if flag == "--no-start" {
+			opts.NoStart = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return opts, fmt.Errorf("missing value for push flag %s", flag)
+		}
+		value := args[i+1]
+		i++
+
+		switch flag {
+		case "-p", "--path":
+			opts.Path = value
+		case "-d", "--domain":
+			opts.Domain = value
+		case "-b", "--buildpack":
+			opts.Buildpacks = append(opts.Buildpacks, value)
+		case "-m", "--memory":
+			memory, err := parseMemory(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.MemoryInMB = memory
+		default:
+			return opts, fmt.Errorf("unsupported push flag %s", flag)
+		}
+	}
+
+	return opts, nil
+}
+
+func parseMemory(value string) (int, error) {
+	upper := strings.ToUpper(value)
+
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(upper, "G"), strings.HasSuffix(upper, "GB"):
+		multiplier = 1024
+	}
+	number := strings.TrimRight(upper, "GMB")
+
+	var memory int
+	if _, err := fmt.Sscanf(number, "%d", &memory); err != nil {
+		return 0, fmt.Errorf("invalid memory %q", value)
+	}
+	return memory * multiplier, nil
+}
@@ -0,0 +1,451 @@
+package ccv3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type Organization struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type Space struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type App struct {
+	GUID  string `json:"guid"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+type Domain struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type ServicePlan struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+// LastOperation is the state of the most recent asynchronous operation on a
+// service instance or binding
+type LastOperation struct {
+	Type        string `json:"type"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+type ServiceInstance struct {
+	GUID          string        `json:"guid"`
+	Name          string        `json:"name"`
+	LastOperation LastOperation `json:"last_operation"`
+}
+
+type CredentialBinding struct {
+	GUID          string        `json:"guid"`
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	LastOperation LastOperation `json:"last_operation"`
+}
+
+type SecurityGroup struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type SecurityGroupRule struct {
+	Protocol    string `json:"protocol"`
+	Destination string `json:"destination"`
+	Ports       string `json:"ports,omitempty"`
+}
+
+// JobError is returned when an asynchronous Cloud Controller job fails
+type JobError struct {
+	Operation string
+	Errors    []string
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("job %s failed: %v", e.Operation, e.Errors)
+}
+
+type relationship struct {
+	Data struct {
+		GUID string `json:"guid"`
+	} `json:"data"`
+}
+
+func relationTo(guid string) relationship {
+	var r relationship
+	r.Data.GUID = guid
+	return r
+}
+
+// first looks up the first resource at path matching query, decoding it into out
+func (c *Client) first(ctx context.Context, path string, query url.Values, resource, name string, out interface{}) error {
+	var page struct {
+		Resources []json.RawMessage `json:"resources"`
+	}
+
+	if _, err := c.do(ctx, http.MethodGet, path+"?"+query.Encode(), nil, &page); err != nil {
+		return err
+	}
+
+	if len(page.Resources) == 0 {
+		return &NotFoundError{Resource: resource, Name: name}
+	}
+
+	return json.Unmarshal(page.Resources[0], out)
+}
+
+func (c *Client) OrganizationByName(ctx context.Context, name string) (Organization, error) {
+	var org Organization
+	err := c.first(ctx, "/v3/organizations", url.Values{"names": {name}}, "Organization", name, &org)
+	return org, err
+}
+
+func (c *Client) SpaceByName(ctx context.Context, orgGUID, name string) (Space, error) {
+	var space Space
+	query := url.Values{"names": {name}, "organization_guids": {orgGUID}}
+	err := c.first(ctx, "/v3/spaces", query, "Space", name, &space)
+	return space, err
+}
+
+func (c *Client) AppByName(ctx context.Context, spaceGUID, name string) (App, error) {
+	var app App
+	query := url.Values{"names": {name}, "space_guids": {spaceGUID}}
+	err := c.first(ctx, "/v3/apps", query, "App", name, &app)
+	return app, err
+}
+
+func (c *Client) CreateApp(ctx context.Context, spaceGUID, name string, buildpacks []string) (App, error) {
+	body := map[string]interface{}{
+		"name": name,
+		"relationships": map[string]interface{}{
+			"space": relationTo(spaceGUID),
+		},
+	}
+	if len(buildpacks) > 0 {
+		body["lifecycle"] = map[string]interface{}{
+			"type": "buildpack",
+			"data": map[string]interface{}{"buildpacks": buildpacks},
+		}
+	}
+
+	var app App
+	_, err := c.do(ctx, http.MethodPost, "/v3/apps", body, &app)
+	return app, err
+}
+
+func (c *Client) StartApp(ctx context.Context, appGUID string) error {
+	_, err := c.do(ctx, http.MethodPost, "/v3/apps/"+appGUID+"/actions/start", nil, nil)
+	return err
+}
+
+func (c *Client) DeleteApp(ctx context.Context, appGUID string) error {
+	header, err := c.do(ctx, http.MethodDelete, "/v3/apps/"+appGUID, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.WaitForJob(ctx, header.Get("Location"))
+}
+
+// SetAppEnv merges vars into the app's user-provided environment variables
+func (c *Client) SetAppEnv(ctx context.Context, appGUID string, vars map[string]string) error {
+	body := map[string]interface{}{"var": vars}
+	_, err := c.do(ctx, http.MethodPatch, "/v3/apps/"+appGUID+"/environment_variables", body, nil)
+	return err
+}
+
+func (c *Client) ScaleApp(ctx context.Context, appGUID string, memoryInMB int) error {
+	body := map[string]interface{}{"memory_in_mb": memoryInMB}
+	_, err := c.do(ctx, http.MethodPost, "/v3/apps/"+appGUID+"/processes/web/actions/scale", body, nil)
+	return err
+}
+
+func (c *Client) DomainByName(ctx context.Context, name string) (Domain, error) {
+	var domain Domain
+	err := c.first(ctx, "/v3/domains", url.Values{"names": {name}}, "Domain", name, &domain)
+	return domain, err
+}
+
+// MapRoute creates the route host.domain if needed and maps it to the app
+func (c *Client) MapRoute(ctx context.Context, spaceGUID, domainGUID, host, appGUID string) error {
+	var route struct {
+		GUID string `json:"guid"`
+	}
+
+	query := url.Values{"hosts": {host}, "domain_guids": {domainGUID}, "space_guids": {spaceGUID}}
+	err := c.first(ctx, "/v3/routes", query, "Route", host, &route)
+	if _, notFound := err.(*NotFoundError); notFound {
+		body := map[string]interface{}{
+			"host": host,
+			"relationships": map[string]interface{}{
+				"space":  relationTo(spaceGUID),
+				"domain": relationTo(domainGUID),
+			},
+		}
+		_, err = c.do(ctx, http.MethodPost, "/v3/routes", body, &route)
+	}
+	if err != nil {
+		return err
+	}
+
+	destinations := map[string]interface{}{
+		"destinations": []interface{}{
+			map[string]interface{}{"app": map[string]string{"guid": appGUID}},
+		},
+	}
+	_, err = c.do(ctx, http.MethodPost, "/v3/routes/"+route.GUID+"/destinations", destinations, nil)
+	return err
+}
+
+func (c *Client) ServicePlanByName(ctx context.Context, offering, plan string) (ServicePlan, error) {
+	var servicePlan ServicePlan
+	query := url.Values{"names": {plan}, "service_offering_names": {offering}}
+	err := c.first(ctx, "/v3/service_plans", query, "Service plan", plan, &servicePlan)
+	return servicePlan, err
+}
+
+// EnableServicePlanForOrg adds the org to the plan's visibility
+func (c *Client) EnableServicePlanForOrg(ctx context.Context, planGUID, orgGUID string) error {
+	body := map[string]interface{}{
+		"type":          "organization",
+		"organizations": []map[string]string{{"guid": orgGUID}},
+	}
+	_, err := c.do(ctx, http.MethodPost, "/v3/service_plans/"+planGUID+"/visibility", body, nil)
+	return err
+}
+
+// DisableServicePlanForOrg removes the org from the plan's visibility
+func (c *Client) DisableServicePlanForOrg(ctx context.Context, planGUID, orgGUID string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/v3/service_plans/"+planGUID+"/visibility/"+orgGUID, nil, nil)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// CreateServiceInstance requests a managed service instance. Provisioning
+// continues asynchronously; watch the instance's LastOperation for the outcome.
+func (c *Client) CreateServiceInstance(ctx context.Context, spaceGUID, planGUID, name string) error {
+	body := map[string]interface{}{
+		"type": "managed",
+		"name": name,
+		"relationships": map[string]interface{}{
+			"space":        relationTo(spaceGUID),
+			"service_plan": relationTo(planGUID),
+		},
+	}
+	_, err := c.do(ctx, http.MethodPost, "/v3/service_instances", body, nil)
+	return err
+}
+
+// ServiceInstanceUpdate is the change requested by UpdateServiceInstance.
+// Empty fields are left as they are.
+type ServiceInstanceUpdate struct {
+	PlanGUID   string
+	Parameters json.RawMessage
+}
+
+// UpdateServiceInstance requests a plan or parameter change. Like
+// CreateServiceInstance it does not wait for the broker to finish.
+func (c *Client) UpdateServiceInstance(ctx context.Context, instanceGUID string, update ServiceInstanceUpdate) error {
+	body := map[string]interface{}{}
+	if update.PlanGUID != "" {
+		body["relationships"] = map[string]interface{}{
+			"service_plan": relationTo(update.PlanGUID),
+		}
+	}
+	if update.Parameters != nil {
+		body["parameters"] = update.Parameters
+	}
+
+	_, err := c.do(ctx, http.MethodPatch, "/v3/service_instances/"+instanceGUID, body, nil)
+	return err
+}
+
+func (c *Client) ServiceInstanceByName(ctx context.Context, spaceGUID, name string) (ServiceInstance, error) {
+	var instance ServiceInstance
+	query := url.Values{"names": {name}, "space_guids": {spaceGUID}}
+	err := c.first(ctx, "/v3/service_instances", query, "Service instance", name, &instance)
+	return instance, err
+}
+
+// DeleteServiceInstance requests deprovisioning. Like CreateServiceInstance it
+// does not wait for the broker to finish.
+func (c *Client) DeleteServiceInstance(ctx context.Context, instanceGUID string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/v3/service_instances/"+instanceGUID, nil, nil)
+	return err
+}
+
+func (c *Client) CreateServiceKey(ctx context.Context, instanceGUID, name string) error {
+	body := map[string]interface{}{
+		"type": "key",
+		"name": name,
+		"relationships": map[string]interface{}{
+			"service_instance": relationTo(instanceGUID),
+		},
+	}
+	return c.createBinding(ctx, body)
+}
+
+func (c *Client) CreateAppBinding(ctx context.Context, instanceGUID, appGUID string) error {
+	body := map[string]interface{}{
+		"type": "app",
+		"relationships": map[string]interface{}{
+			"service_instance": relationTo(instanceGUID),
+			"app":              relationTo(appGUID),
+		},
+	}
+	return c.createBinding(ctx, body)
+}
+
+func (c *Client) createBinding(ctx context.Context, body map[string]interface{}) error {
+	header, err := c.do(ctx, http.MethodPost, "/v3/service_credential_bindings", body, nil)
+	if err != nil {
+		return err
+	}
+	return c.WaitForJob(ctx, header.Get("Location"))
+}
+
+// CredentialBindings lists the bindings of a service instance of the given
+// type, "key" or "app", optionally narrowed to an app
+func (c *Client) CredentialBindings(ctx context.Context, instanceGUID, bindingType, appGUID string) ([]CredentialBinding, error) {
+	query := url.Values{"service_instance_guids": {instanceGUID}, "type": {bindingType}}
+	if appGUID != "" {
+		query.Set("app_guids", appGUID)
+	}
+
+	var page struct {
+		Resources []CredentialBinding `json:"resources"`
+	}
+	_, err := c.do(ctx, http.MethodGet, "/v3/service_credential_bindings?"+query.Encode(), nil, &page)
+	return page.Resources, err
+}
+
+// CredentialBindingDetails returns the raw credentials of a binding
+func (c *Client) CredentialBindingDetails(ctx context.Context, bindingGUID string) (json.RawMessage, error) {
+	var details struct {
+		Credentials json.RawMessage `json:"credentials"`
+	}
+	_, err := c.do(ctx, http.MethodGet, "/v3/service_credential_bindings/"+bindingGUID+"/details", nil, &details)
+	return details.Credentials, err
+}
+
+func (c *Client) DeleteCredentialBinding(ctx context.Context, bindingGUID string) error {
+	header, err := c.do(ctx, http.MethodDelete, "/v3/service_credential_bindings/"+bindingGUID, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.WaitForJob(ctx, header.Get("Location"))
+}
+
+func (c *Client) SecurityGroupByName(ctx context.Context, name string) (SecurityGroup, error) {
+	var group SecurityGroup
+	err := c.first(ctx, "/v3/security_groups", url.Values{"names": {name}}, "Security group", name, &group)
+	return group, err
+}
+
+func (c *Client) CreateSecurityGroup(ctx context.Context, name string, rules []SecurityGroupRule) (SecurityGroup, error) {
+	body := map[string]interface{}{"name": name, "rules": rules}
+
+	var group SecurityGroup
+	_, err := c.do(ctx, http.MethodPost, "/v3/security_groups", body, &group)
+	return group, err
+}
+
+// BindSecurityGroupToSpace applies the group to running apps in the space
+func (c *Client) BindSecurityGroupToSpace(ctx context.Context, groupGUID, spaceGUID string) error {
+	body := map[string]interface{}{"data": []map[string]string{{"guid": spaceGUID}}}
+	_, err := c.do(ctx, http.MethodPost, "/v3/security_groups/"+groupGUID+"/relationships/running_spaces", body, nil)
+	return err
+}
+
+func (c *Client) DeleteSecurityGroup(ctx context.Context, groupGUID string) error {
+	header, err := c.do(ctx, http.MethodDelete, "/v3/security_groups/"+groupGUID, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.WaitForJob(ctx, header.Get("Location"))
+}
+
+// WaitForJob polls the job at location until it completes. An empty location,
+// from a request that finished synchronously, returns immediately.
+func (c *Client) WaitForJob(ctx context.Context, location string) error {
+	if location == "" {
+		return nil
+	}
+
+	for {
+		var job struct {
+			Operation string `json:"operation"`
+			State     string `json:"state"`
+			Errors    []struct {
+				Detail string `json:"detail"`
+			} `json:"errors"`
+		}
+
+		if _, err := c.send(ctx, http.MethodGet, location, nil, "", &job); err != nil {
+			return err
+		}
+
+		switch job.State {
+		case "COMPLETE":
+			return nil
+		case "FAILED":
+			jobErr := &JobError{Operation: job.Operation}
+			for _, e := range job.Errors {
+				jobErr.Errors = append(jobErr.Errors, e.Detail)
+			}
+			return jobErr
+		}
+
+		if err := pause(ctx, c.poll); err != nil {
+			return err
+		}
+	}
+}
+
+func pause(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeleteAppRoutes deletes every route mapped to the app
+func (c *Client) DeleteAppRoutes(ctx context.Context, appGUID string) error {
+	var page struct {
+		Resources []struct {
+			GUID string `json:"guid"`
+		} `json:"resources"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/v3/apps/"+appGUID+"/routes", nil, &page); err != nil {
+		return err
+	}
+
+	for _, route := range page.Resources {
+		header, err := c.do(ctx, http.MethodDelete, "/v3/routes/"+route.GUID, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := c.WaitForJob(ctx, header.Get("Location")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -14,26 +14,52 @@ import (
 	"github.com/cloudfoundry-incubator/cf-test-helpers/helpers"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
 )
 
 // CF is a testing wrapper around the cf cli
 type CF struct {
+	// ShortTimeout bounds a single cf command
 	ShortTimeout time.Duration
+	// LongTimeout bounds all attempts of an operation, including backoffs
 	LongTimeout  time.Duration
 	MaxRetries   int
 	RetryBackoff retry.Backoff
-}
-
-type Credentials struct {
-	Host         string
-	Port         int
-	TLS_Port     int
-	TLS_Versions []string
+	// AsyncOperationTimeout bounds waiting for a broker's asynchronous
+	// operation; LongTimeout is used when it is not set
+	AsyncOperationTimeout time.Duration
+	// AsyncPollInterval is how often an asynchronous operation is polled;
+	// five seconds is used when it is not set
+	AsyncPollInterval time.Duration
+	// Breaker, if set, short-circuits operations while the Cloud Controller is unavailable
+	Breaker *retry.Breaker
+	// CC, if set, is used instead of the cf CLI for targeting the space,
+	// apps, plan access, service instances, bindings, keys and security
+	// groups. It is not a replacement for the CLI: quotas, orgs, spaces,
+	// users, offering-wide service access, EnsureAllServiceInstancesGone and
+	// Logout still run cf, so it must be installed either way.
+	CC CloudController
+	// Observer, if set, is notified of every attempt of every operation
+	Observer retry.Observer
+}
+
+// NewCloudControllerBreaker returns a breaker for CF.Breaker that opens after
+// threshold consecutive operations fail and probes again after coolDown
+func NewCloudControllerBreaker(threshold int, coolDown time.Duration) *retry.Breaker {
+	return retry.NewBreaker(
+		threshold,
+		coolDown,
+		failreason.New(failreason.CloudControllerUnavailable, "Cloud Controller unavailable: %d consecutive operations failed, skipping until it recovers", threshold).String(),
+	)
 }
 
 // API is equivalent to `cf api {endpoint} [--skip-ssl-validation]`
 func (cf *CF) API(endpoint string, skipSSLValidation bool) func() {
+	if cf.CC != nil {
+		return cf.ccAPI()
+	}
+
 	apiCmd := []string{"api", endpoint}
 
 	if skipSSLValidation {
@@ -45,37 +71,45 @@ func (cf *CF) API(endpoint string, skipSSLValidation bool) func() {
 	}
 
 	return func() {
-		retry.Session(cfApiFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(cfApiFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to target Cloud Foundry"}`,
+			failreason.New(failreason.TargetFailed, "Failed to target Cloud Foundry").String(),
 		)
 	}
 }
 
 // Auth is equivalent to `cf auth {user} {password}`
 func (cf *CF) Auth(user, password string) func() {
+	if cf.CC != nil {
+		return cf.ccAuth(user, password)
+	}
+
 	authFn := func() *gexec.Session {
 		return helpersCF.Cf("auth", user, password)
 	}
 
 	return func() {
-		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			"{\"FailReason\": \"Failed to `cf auth` with target Cloud Foundry\"}",
+			failreason.New(failreason.AuthFailed, "Failed to `cf auth` with target Cloud Foundry").String(),
 		)
 	}
 }
 
 // Auth is equivalent to `cf auth {client} {client-secret} --client-credentials`
 func (cf *CF) AuthClient(client, clientSecret string) func() {
+	if cf.CC != nil {
+		return cf.ccAuthClient(client, clientSecret)
+	}
+
 	authFn := func() *gexec.Session {
 		return helpersCF.Cf("auth", client, clientSecret, "--client-credentials")
 	}
 
 	return func() {
-		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			"{\"FailReason\": \"Failed to `cf auth` with target Cloud Foundry\"}",
+			failreason.New(failreason.AuthFailed, "Failed to `cf auth` with target Cloud Foundry").String(),
 		)
 	}
 }
@@ -89,9 +123,9 @@ func (cf *CF) CreateQuota(name string, args ...string) func() {
 	}
 
 	return func() {
-		retry.Session(createQuotaFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createQuotaFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			"{\"FailReason\": \"Failed to `cf create-quota` with target Cloud Foundry\"}",
+			failreason.New(failreason.QuotaCreateFailed, "Failed to `cf create-quota` with target Cloud Foundry").With("quota", name).String(),
 		)
 	}
 }
@@ -103,9 +137,9 @@ func (cf *CF) DeleteOrg(name string) func() {
 	}
 
 	return func() {
-		retry.Session(deleteOrg).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteOrg).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to delete org"}`,
+			failreason.New(failreason.OrgDeleteFailed, "Failed to delete org").With("org", name).String(),
 		)
 	}
 }
@@ -117,9 +151,9 @@ func (cf *CF) CreateOrg(org, quota string) func() {
 	}
 
 	return func() {
-		retry.Session(createOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to create org"}`,
+			failreason.New(failreason.OrgCreateFailed, "Failed to create org").With("org", org).With("quota", quota).String(),
 		)
 	}
 }
@@ -135,13 +169,13 @@ func (cf *CF) EnableServiceAccess(org, service string) func() {
 	}
 
 	return func() {
-		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to disable service access for CF test org"}`,
+			failreason.New(failreason.ServiceAccessFailed, "Failed to disable service access for CF test org").With("org", org).With("service_offering", service).String(),
 		)
-		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to enable service access for CF test org"}`,
+			failreason.New(failreason.ServiceAccessFailed, "Failed to enable service access for CF test org").With("org", org).With("service_offering", service).String(),
 		)
 	}
 }
@@ -149,6 +183,10 @@ func (cf *CF) EnableServiceAccess(org, service string) func() {
 // EnableServiceAccessForPlan is equivalent to `cf enable-service-access -o {org} {service-offering} -p {service-plan}`
 // In order to run enable-service-access idempotently we disable-service-access before.
 func (cf *CF) EnableServiceAccessForPlan(org, service, plan string) func() {
+	if cf.CC != nil {
+		return cf.ccEnableServiceAccessForPlan(org, service, plan)
+	}
+
 	disableServiceAccessFn := func() *gexec.Session {
 		return helpersCF.Cf("disable-service-access", "-o", org, service, "-p", plan)
 	}
@@ -157,13 +195,13 @@ func (cf *CF) EnableServiceAccessForPlan(org, service, plan string) func() {
 	}
 
 	return func() {
-		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to disable service access for CF test org"}`,
+			failreason.New(failreason.ServiceAccessFailed, "Failed to disable service access for CF test org").With("org", org).With("service_offering", service).With("plan", plan).String(),
 		)
-		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to enable service access for CF test org"}`,
+			failreason.New(failreason.ServiceAccessFailed, "Failed to enable service access for CF test org").With("org", org).With("service_offering", service).With("plan", plan).String(),
 		)
 	}
 }
@@ -174,23 +212,27 @@ func (cf *CF) TargetOrg(org string) func() {
 		return helpersCF.Cf("target", "-o", org)
 	}
 	return func() {
-		retry.Session(targetOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(targetOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to target test org"}`,
+			failreason.New(failreason.TargetOrgFailed, "Failed to target test org").With("org", org).String(),
 		)
 	}
 }
 
 // TargetOrgAndSpace is equivalent to `cf target -o {org} -s {space}`
 func (cf *CF) TargetOrgAndSpace(org, space string) func() {
+	if cf.CC != nil {
+		return cf.ccTargetOrgAndSpace(org, space)
+	}
+
 	targetFn := func() *gexec.Session {
 		return helpersCF.Cf("target", "-o", org, "-s", space)
 	}
 
 	return func() {
-		retry.Session(targetFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(targetFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to target test org"}`,
+			failreason.New(failreason.TargetOrgFailed, "Failed to target test org").With("org", org).With("space", space).String(),
 		)
 	}
 }
@@ -202,17 +244,22 @@ func (cf *CF) CreateSpace(space string) func() {
 	}
 
 	return func() {
-		retry.Session(createSpaceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createSpaceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to create CF test space"}`,
+			failreason.New(failreason.SpaceCreateFailed, "Failed to create CF test space").With("space", space).String(),
 		)
 	}
 }
 
 // CreateSecurityGroup is equivalent to `cf create-security-group {securityGroup} {configPath}`
 func (cf *CF) CreateAndBindSecurityGroup(securityGroup, serviceName, org, space string) func() {
+	if cf.CC != nil {
+		return cf.ccCreateAndBindSecurityGroup(securityGroup, serviceName)
+	}
+
 	return func() {
-		destination, ports := cf.securityGroupDestination(serviceName)
+		serviceGuid := cf.getServiceInstanceGuid(serviceName)
+		destination, ports := cf.securityGroupDestination(cf.getServiceKeyCredentials(serviceGuid))
 
 		sgFile, err := ioutil.TempFile("", "smoke-test-security-group-")
 		Expect(err).NotTo(HaveOccurred())
@@ -228,24 +275,21 @@ func (cf *CF) CreateAndBindSecurityGroup(securityGroup, serviceName, org, space
 		}
 
 		err = json.NewEncoder(sgFile).Encode(sgs)
-		Expect(err).NotTo(HaveOccurred(), `{"FailReason": "Failed to encode security groups"}`)
+		Expect(err).NotTo(HaveOccurred(), failreason.New(failreason.SecurityGroupCreateFailed, "Failed to encode security groups").With("security_group", securityGroup).String())
 
 		Eventually(helpersCF.Cf("create-security-group", securityGroup, sgFile.Name()), cf.ShortTimeout).Should(
 			gexec.Exit(0),
-			`{"FailReason": "Failed to create security group"}`,
+			failreason.New(failreason.SecurityGroupCreateFailed, "Failed to create security group").With("security_group", securityGroup).String(),
 		)
 
 		Eventually(helpersCF.Cf("bind-security-group", securityGroup, org, space), cf.ShortTimeout).Should(
 			gexec.Exit(0),
-			`{"FailReason": "Failed to bind security group to space"}`,
+			failreason.New(failreason.SecurityGroupBindFailed, "Failed to bind security group to space").With("security_group", securityGroup).With("space", space).String(),
 		)
 	}
 }
 
-func (cf *CF) securityGroupDestination(serviceName string) (string, string) {
-	serviceGuid := cf.getServiceInstanceGuid(serviceName)
-	creds := cf.getServiceKeyCredentials(serviceGuid)
-
+func (cf *CF) securityGroupDestination(creds Credentials) (string, string) {
 	destination := "0.0.0.0/0"
 	if os.Getenv("ENABLE_ALL_DESTINATIONS") != "true" {
 		session := helpers.Run("dig", "+short", creds.Host)
@@ -269,14 +313,18 @@ func (cf *CF) securityGroupDestination(serviceName string) (string, string) {
 
 // DeleteSecurityGroup is equivalent to `cf delete-security-group {securityGroup} -f`
 func (cf *CF) DeleteSecurityGroup(securityGroup string) func() {
+	if cf.CC != nil {
+		return cf.ccDeleteSecurityGroup(securityGroup)
+	}
+
 	delSecGroupFn := func() *gexec.Session {
 		return helpersCF.Cf("delete-security-group", securityGroup, "-f")
 	}
 
 	return func() {
-		retry.Session(delSecGroupFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(delSecGroupFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to delete security group"}`,
+			failreason.New(failreason.SecurityGroupDeleteFailed, "Failed to delete security group").With("security_group", securityGroup).String(),
 		)
 	}
 }
@@ -290,9 +338,9 @@ func (cf *CF) CreateUser(name, password string) func() {
 
 	// if the user already exists, `cf create-user {name} {password}` is still OK
 	return func() {
-		retry.Session(createUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to create user"}`,
+			failreason.New(failreason.UserCreateFailed, "Failed to create user").With("user", name).String(),
 		)
 	}
 }
@@ -304,9 +352,9 @@ func (cf *CF) DeleteUser(name string) func() {
 	}
 
 	return func() {
-		retry.Session(deleteUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to delete user"}`,
+			failreason.New(failreason.UserDeleteFailed, "Failed to delete user").With("user", name).String(),
 		)
 	}
 }
@@ -318,15 +366,19 @@ func (cf *CF) SetSpaceRole(name, org, space, role string) func() {
 	}
 
 	return func() {
-		retry.Session(setSpaceRoleFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(setSpaceRoleFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to set space role"}`,
+			failreason.New(failreason.SpaceRoleFailed, "Failed to set space role").With("user", name).With("space", space).String(),
 		)
 	}
 }
 
 // Push is equivalent to `cf push {appName} [args...]`
 func (cf *CF) Push(appName string, args ...string) func() {
+	if cf.CC != nil {
+		return cf.ccPush(appName, args...)
+	}
+
 	pushArgs := []string{"push", appName}
 	pushArgs = append(pushArgs, args...)
 
@@ -335,29 +387,37 @@ func (cf *CF) Push(appName string, args ...string) func() {
 	}
 
 	return func() {
-		retry.Session(pushFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(pushFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			"{\"FailReason\": \"Failed to `cf push` test app\"}",
+			failreason.New(failreason.AppPushFailed, "Failed to `cf push` test app").With("app", appName).String(),
 		)
 	}
 }
 
 // Delete is equivalent to `cf delete {appName} -f`
 func (cf *CF) Delete(appName string) func() {
+	if cf.CC != nil {
+		return cf.ccDelete(appName)
+	}
+
 	deleteAppFn := func() *gexec.Session {
 		return helpersCF.Cf("delete", appName, "-f", "-r")
 	}
 
 	return func() {
-		retry.Session(deleteAppFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteAppFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			"{\"FailReason\": \"Failed to `cf delete` test app\"}",
+			failreason.New(failreason.AppDeleteFailed, "Failed to `cf delete` test app").With("app", appName).String(),
 		)
 	}
 }
 
 // CreateService is equivalent to `cf create-service {serviceName} {planName} {instanceName}`
 func (cf *CF) CreateService(serviceName, planName, instanceName string, skip *bool) func() {
+	if cf.CC != nil {
+		return cf.ccCreateService(serviceName, planName, instanceName, skip)
+	}
+
 	createServiceFn := func() *gexec.Session {
 		return helpersCF.Cf("create-service", serviceName, planName, instanceName)
 	}
@@ -385,59 +445,78 @@ func (cf *CF) CreateService(serviceName, planName, instanceName string, skip *bo
 	successfulCreateServiceConditions := []retry.Condition{succeeds, quotaReached}
 
 	return func() {
-		retry.Session(createServiceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).UntilAny(
+		retry.Session(createServiceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).UntilAny(
 			successfulCreateServiceConditions,
-			`{"FailReason": "Failed to create Redis service instance"}`,
+			failreason.New(failreason.ServiceCreateFailed, "Failed to create Redis service instance").With("service_instance", instanceName).With("plan", planName).String(),
 		)
 		if !(*skip) {
-			cf.awaitServiceCreation(instanceName)
+			cf.awaitCreation(planName, instanceName, skip, failreason.New(failreason.ServiceCreateFailed, "Failed to create Redis service instance").With("service_instance", instanceName).With("plan", planName))
 		}
 	}
 }
 
-func (cf *CF) awaitServiceCreation(instanceName string) {
-	serviceFn := func() *gexec.Session {
-		return helpersCF.Cf("service", instanceName)
+// DeleteService is equivalent to `cf delete-service {instanceName} -f`
+func (cf *CF) DeleteService(instanceName string) func() {
+	if cf.CC != nil {
+		return cf.ccDeleteService(instanceName)
 	}
 
-	// longer retry backoff due to asynchronous creates
-	backoff := retry.Exponential(time.Second)
-	maxRetries := 10
+	deleteFn := func() *gexec.Session {
+		return helpersCF.Cf("delete-service", "-f", instanceName)
+	}
 
-	retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Until(
-		retry.MatchesOutput(regexp.MustCompile("create succeeded")),
-		fmt.Sprintf(`{"FailReason": "Failed to create Redis service instance %s"}`, instanceName),
-	)
+	return func() {
+		retry.Session(deleteFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
+			retry.Succeeds,
+			failreason.New(failreason.ServiceDeleteFailed, "Failed to delete service").With("service_instance", instanceName).String(),
+		)
+	}
 }
 
-// DeleteService is equivalent to `cf delete-service {instanceName} -f`
-func (cf *CF) DeleteService(instanceName string) func() {
-	deleteFn := func() *gexec.Session {
-		return helpersCF.Cf("delete-service", "-f", instanceName)
+// UpdateService is equivalent to `cf update-service {instanceName} -p {planName}`,
+// waiting for the broker to finish the plan change
+func (cf *CF) UpdateService(serviceName, planName, instanceName string) func() {
+	if cf.CC != nil {
+		return cf.ccUpdateService(serviceName, planName, instanceName)
+	}
+
+	updateFn := func() *gexec.Session {
+		return helpersCF.Cf("update-service", instanceName, "-p", planName)
 	}
 
 	return func() {
-		retry.Session(deleteFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(updateFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(append(fatalErrors, planChangeRejected)...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			fmt.Sprintf(`{"FailReason": "Failed to delete service %s"}`, instanceName),
+			failreason.New(failreason.PlanChangeFailed, "Failed to update service to plan").With("service_instance", instanceName).With("plan", planName).String(),
 		)
+		cf.awaitLastOperation(instanceName, "update", failreason.New(failreason.PlanChangeFailed, "Failed to update Redis service instance to plan").With("service_instance", instanceName).With("plan", planName))
 	}
 }
 
-func (cf *CF) EnsureServiceInstanceGone(instanceName string) func() {
-	serviceFn := func() *gexec.Session {
-		return helpersCF.Cf("service", instanceName)
+// UpdateServiceParameters is equivalent to `cf update-service {instanceName} -c {parameters}`,
+// waiting for the broker to finish the update
+func (cf *CF) UpdateServiceParameters(instanceName, parameters string) func() {
+	if cf.CC != nil {
+		return cf.ccUpdateServiceParameters(instanceName, parameters)
 	}
 
-	// longer retry backoff due to asynchronous deletes
-	backoff := retry.Exponential(time.Second)
-	maxRetries := 10
+	updateFn := func() *gexec.Session {
+		return helpersCF.Cf("update-service", instanceName, "-c", parameters)
+	}
 
 	return func() {
-		retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Until(
-			retry.MatchesErrorOutput(regexp.MustCompile(fmt.Sprintf("Service instance %s not found", instanceName))),
-			fmt.Sprintf(`{"FailReason": "Failed to make sure service %s does not exist"}`, instanceName),
+		retry.Session(updateFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
+			retry.Succeeds,
+			failreason.New(failreason.ServiceUpdateFailed, "Failed to update service").With("service_instance", instanceName).String(),
 		)
+		cf.awaitLastOperation(instanceName, "update", failreason.New(failreason.ServiceUpdateFailed, "Failed to update Redis service instance").With("service_instance", instanceName))
+	}
+}
+
+// EnsureServiceInstanceGone waits until the instance's deletion has finished
+func (cf *CF) EnsureServiceInstanceGone(instanceName string) func() {
+	return func() {
+		cf.awaitDeletion(instanceName, failreason.New(failreason.ServiceDeleteFailed, "Failed to make sure service does not exist").With("service_instance", instanceName))
 	}
 }
 
@@ -451,29 +530,37 @@ func (cf *CF) EnsureAllServiceInstancesGone() func() {
 	maxRetries := 10
 
 	return func() {
-		retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Until(
+		retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.MatchesOutput(regexp.MustCompile("No services found")),
-			`{"FailReason": "Failed to make sure no service instances exist"}`,
+			failreason.New(failreason.ServiceCleanupFailed, "Failed to make sure no service instances exist").String(),
 		)
 	}
 }
 
 // BindService is equivalent to `cf bind-service {appName} {instanceName}`
 func (cf *CF) BindService(appName, instanceName string) func() {
+	if cf.CC != nil {
+		return cf.ccBindService(appName, instanceName)
+	}
+
 	bindFn := func() *gexec.Session {
 		return helpersCF.Cf("bind-service", appName, instanceName)
 	}
 
 	return func() {
-		retry.Session(bindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(bindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to bind Redis service instance to test app"}`,
+			failreason.New(failreason.BindFailed, "Failed to bind Redis service instance to test app").With("app", appName).With("service_instance", instanceName).String(),
 		)
 	}
 }
 
 // UnbindService is equivalent to `cf unbind-service {appName} {instanceName}`
 func (cf *CF) UnbindService(appName, instanceName string) func() {
+	if cf.CC != nil {
+		return cf.ccUnbindService(appName, instanceName)
+	}
+
 	unbindFn := func() *gexec.Session {
 		return helpersCF.Cf("unbind-service", appName, instanceName)
 	}
@@ -484,37 +571,45 @@ func (cf *CF) UnbindService(appName, instanceName string) func() {
 	}
 
 	return func() {
-		retry.Session(unbindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).UntilAny(
+		retry.Session(unbindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).UntilAny(
 			successfulUnbindConditions,
-			fmt.Sprintf(`{"FailReason": "Failed to unbind %s instance from %s"}`, instanceName, appName),
+			failreason.New(failreason.UnbindFailed, "Failed to unbind service instance from app").With("app", appName).With("service_instance", instanceName).String(),
 		)
 	}
 }
 
 // Start is equivalent to `cf start {appName}`
 func (cf *CF) Start(appName string) func() {
+	if cf.CC != nil {
+		return cf.ccStart(appName)
+	}
+
 	startFn := func() *gexec.Session {
 		return helpersCF.Cf("start", appName)
 	}
 
 	return func() {
-		retry.Session(startFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(startFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to start test app"}`,
+			failreason.New(failreason.AppStartFailed, "Failed to start test app").With("app", appName).String(),
 		)
 	}
 }
 
 // SetEnv is equivalent to `cf set-env {appName} {envVarName} {instanceName}`
 func (cf *CF) SetEnv(appName, environmentVariable, instanceName string) func() {
+	if cf.CC != nil {
+		return cf.ccSetEnv(appName, environmentVariable, instanceName)
+	}
+
 	setEnvFn := func() *gexec.Session {
 		return helpersCF.Cf("set-env", appName, environmentVariable, instanceName)
 	}
 
 	return func() {
-		retry.Session(setEnvFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(setEnvFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to set environment variable for test app"}`,
+			failreason.New(failreason.AppEnvFailed, "Failed to set environment variable for test app").With("app", appName).String(),
 		)
 	}
 }
@@ -526,72 +621,93 @@ func (cf *CF) Logout() func() {
 	}
 
 	return func() {
-		retry.Session(logoutFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(logoutFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to logout"}`,
+			failreason.New(failreason.LogoutFailed, "Failed to logout").String(),
 		)
 	}
 }
 
 func (cf CF) GetServiceKey(serviceInstanceName string, credentials *Credentials) func() {
 	return func() {
+		if cf.CC != nil {
+			*credentials = cf.ccServiceKeyCredentials(serviceInstanceName)
+			return
+		}
+
 		serviceGUID := cf.getServiceInstanceGuid(serviceInstanceName)
 		*credentials = cf.getServiceKeyCredentials(serviceGUID)
 	}
 }
 
 func (cf CF) CreateServiceKey(serviceInstanceName, serviceKeyName string) func() {
+	if cf.CC != nil {
+		return cf.ccCreateServiceKey(serviceInstanceName, serviceKeyName)
+	}
+
 	serviceKeyFn := func() *gexec.Session {
 		return helpersCF.Cf("create-service-key", serviceInstanceName, serviceKeyName)
 	}
 
 	return func() {
-		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to create service key for Redis service instance"}`,
+			failreason.New(failreason.ServiceKeyCreateFailed, "Failed to create service key for Redis service instance").With("service_instance", serviceInstanceName).With("service_key", serviceKeyName).String(),
 		)
 	}
 }
 
 func (cf CF) DeleteServiceKey(serviceInstanceName, serviceKeyName string) func() {
+	if cf.CC != nil {
+		return cf.ccDeleteServiceKey(serviceInstanceName, serviceKeyName)
+	}
+
 	serviceKeyFn := func() *gexec.Session {
 		return helpersCF.Cf("delete-service-key", "-f", serviceInstanceName, serviceKeyName)
 	}
 
 	return func() {
-		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).AndBudget(cf.LongTimeout).AndAbort(fatalErrors...).AndBreaker(cf.Breaker).AndObserver(cf.Observer).Until(
 			retry.Succeeds,
-			`{"FailReason": "Failed to delete service key for Redis service instance"}`,
+			failreason.New(failreason.ServiceKeyDeleteFailed, "Failed to delete service key for Redis service instance").With("service_instance", serviceInstanceName).With("service_key", serviceKeyName).String(),
 		)
 	}
 }
 
 func (cf *CF) getServiceInstanceGuid(serviceName string) string {
 	session := helpersCF.Cf("service", "--guid", serviceName)
-	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), `{"FailReason": "Failed to retrieve GUID for service instance"}`)
+	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), failreason.New(failreason.ServiceKeyFetchFailed, "Failed to retrieve GUID for service instance").With("service_instance", serviceName).String())
 
 	return strings.Trim(string(session.Out.Contents()), " \n")
 }
 
 func (cf *CF) getServiceKeyCredentials(serviceGuid string) Credentials {
-	session := helpersCF.Cf("curl", fmt.Sprintf("/v2/service_keys?q=service_instance_guid:%s", serviceGuid))
-	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), `{"FailReason": "Failed to retrieve service bindings for app"}`)
+	session := helpersCF.Cf("curl", fmt.Sprintf("/v3/service_credential_bindings?type=key&service_instance_guids=%s", serviceGuid))
+	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), failreason.New(failreason.ServiceKeyFetchFailed, "Failed to retrieve service keys for Redis service instance").With("service_instance_guid", serviceGuid).String())
 
-	var resp = new(struct {
+	var keys = new(struct {
 		Resources []struct {
-			Entity struct {
-				Credentials Credentials
-			}
+			GUID string
 		}
 	})
 
-	err := json.NewDecoder(bytes.NewBuffer(session.Out.Contents())).Decode(resp)
-	Expect(err).NotTo(HaveOccurred(), `{"FailReason": "Failed to decode service key response"}`)
-	Expect(resp.Resources).To(HaveLen(1), `{"FailReason": "Invalid service key response, expected exactly one service key"}`)
+	err := json.NewDecoder(bytes.NewBuffer(session.Out.Contents())).Decode(keys)
+	Expect(err).NotTo(HaveOccurred(), failreason.New(failreason.ServiceKeyFetchFailed, "Failed to decode service key response").With("service_instance_guid", serviceGuid).String())
+	Expect(keys.Resources).To(HaveLen(1), failreason.New(failreason.ServiceKeyInvalid, "Invalid service key response, expected exactly one service key").With("service_instance_guid", serviceGuid).String())
+
+	session = helpersCF.Cf("curl", fmt.Sprintf("/v3/service_credential_bindings/%s/details", keys.Resources[0].GUID))
+	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), failreason.New(failreason.ServiceKeyFetchFailed, "Failed to retrieve service key details").With("service_key_guid", keys.Resources[0].GUID).String())
+
+	var details = new(struct {
+		Credentials Credentials
+	})
+
+	err = json.NewDecoder(bytes.NewBuffer(session.Out.Contents())).Decode(details)
+	Expect(err).NotTo(HaveOccurred(), failreason.New(failreason.ServiceKeyFetchFailed, "Failed to decode service key details").With("service_key_guid", keys.Resources[0].GUID).String())
 
-	host, port := resp.Resources[0].Entity.Credentials.Host, resp.Resources[0].Entity.Credentials.Port
-	Expect(host).NotTo(BeEmpty(), `{"FailReason": "Invalid service key, missing host"}`)
-	Expect(port).NotTo(BeZero(), `{"FailReason": "Invalid service key, missing port"}`)
+	host, port := details.Credentials.Host, details.Credentials.Port
+	Expect(host).NotTo(BeEmpty(), failreason.New(failreason.ServiceKeyInvalid, "Invalid service key, missing host").With("service_key_guid", keys.Resources[0].GUID).String())
+	Expect(port).NotTo(BeZero(), failreason.New(failreason.ServiceKeyInvalid, "Invalid service key, missing port").With("service_key_guid", keys.Resources[0].GUID).String())
 
-	return resp.Resources[0].Entity.Credentials
+	return details.Credentials
 }
@@ -0,0 +1,13 @@
+package cf_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCF(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CF Suite")
+}
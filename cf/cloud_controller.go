@@ -0,0 +1,541 @@
+package cf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// CloudController is the Cloud Controller API that CF methods use instead of
+// the cf CLI when CF.CC is set. *ccv3.Client implements it. It does not cover
+// quotas, orgs, spaces, users, offering-wide service access,
+// EnsureAllServiceInstancesGone or Logout, which still shell out to cf.
+type CloudController interface {
+	Info(ctx context.Context) (string, error)
+	Login(ctx context.Context, user, password string) error
+	LoginClient(ctx context.Context, client, secret string) error
+	Target(orgGUID, spaceGUID string)
+	Targeted() (orgGUID, spaceGUID string)
+
+	OrganizationByName(ctx context.Context, name string) (ccv3.Organization, error)
+	SpaceByName(ctx context.Context, orgGUID, name string) (ccv3.Space, error)
+
+	AppByName(ctx context.Context, spaceGUID, name string) (ccv3.App, error)
+	Push(ctx context.Context, spaceGUID, name string, opts ccv3.PushOptions) (ccv3.App, error)
+	StartApp(ctx context.Context, appGUID string) error
+	SetAppEnv(ctx context.Context, appGUID string, vars map[string]string) error
+	DeleteAppRoutes(ctx context.Context, appGUID string) error
+	DeleteApp(ctx context.Context, appGUID string) error
+
+	ServicePlanByName(ctx context.Context, offering, plan string) (ccv3.ServicePlan, error)
+	EnableServicePlanForOrg(ctx context.Context, planGUID, orgGUID string) error
+	DisableServicePlanForOrg(ctx context.Context, planGUID, orgGUID string) error
+
+	CreateServiceInstance(ctx context.Context, spaceGUID, planGUID, name string) error
+	ServiceInstanceByName(ctx context.Context, spaceGUID, name string) (ccv3.ServiceInstance, error)
+	UpdateServiceInstance(ctx context.Context, instanceGUID string, update ccv3.ServiceInstanceUpdate) error
+	DeleteServiceInstance(ctx context.Context, instanceGUID string) error
+
+	CreateServiceKey(ctx context.Context, instanceGUID, name string) error
+	CreateAppBinding(ctx context.Context, instanceGUID, appGUID string) error
+	CredentialBindings(ctx context.Context, instanceGUID, bindingType, appGUID string) ([]ccv3.CredentialBinding, error)
+	CredentialBindingDetails(ctx context.Context, bindingGUID string) (json.RawMessage, error)
+	DeleteCredentialBinding(ctx context.Context, bindingGUID string) error
+
+	SecurityGroupByName(ctx context.Context, name string) (ccv3.SecurityGroup, error)
+	CreateSecurityGroup(ctx context.Context, name string, rules []ccv3.SecurityGroupRule) (ccv3.SecurityGroup, error)
+	BindSecurityGroupToSpace(ctx context.Context, groupGUID, spaceGUID string) error
+	DeleteSecurityGroup(ctx context.Context, groupGUID string) error
+}
+
+func (cf *CF) ccPolicy() retry.Policy {
+	return retry.Policy{
+		SessionTimeout: cf.ShortTimeout,
+		Backoff:        cf.RetryBackoff,
+		MaxRetries:     cf.MaxRetries,
+		Budget:         cf.LongTimeout,
+		Breaker:        cf.Breaker,
+		Classifier:     ccFatal,
+		Observers:      cf.observers(),
+	}
+}
+
+func (cf *CF) observers() []retry.Observer {
+	if cf.Observer == nil {
+		return nil
+	}
+	return []retry.Observer{cf.Observer}
+}
+
+// ccFatal treats client errors and missing resources as fatal; server errors,
+// rate limiting and network errors are retried
+func ccFatal(result interface{}, err error) (string, bool) {
+	var (
+		apiErr   *ccv3.APIError
+		notFound *ccv3.NotFoundError
+	)
+
+	switch {
+	case errors.As(err, &notFound):
+		return notFound.Error(), true
+	case errors.As(err, &apiErr) && !apiErr.Temporary():
+		return apiErr.Error(), true
+	default:
+		return "", false
+	}
+}
+
+// ccDo retries op against the Cloud Controller, failing with failure if it never succeeds
+func (cf *CF) ccDo(failure failreason.Failure, op func(ctx context.Context) error) {
+	attempt := func(ctx context.Context) (interface{}, error) {
+		return nil, op(ctx)
+	}
+
+	_, err := cf.ccPolicy().Do(context.Background(), attempt, retry.NoError)
+	failOperation(failure, err)
+}
+
+// failOperation fails the spec if a retried operation returned err, using the
+// most precise reason available
+func failOperation(failure failreason.Failure, err error) {
+	if err == nil {
+		return
+	}
+
+	var (
+		fatal *retry.FatalError
+		open  *retry.BreakerOpenError
+	)
+	switch {
+	case errors.As(err, &fatal):
+		if quotaExceeded.MatchString(fatal.Reason) {
+			failure.Code = failreason.QuotaReached
+		}
+		ginkgo.Fail(failure.Wrap(fatal.Reason).String())
+	case errors.As(err, &open):
+		ginkgo.Fail(open.Reason)
+	case errors.Is(err, retry.ErrBudgetExhausted):
+		ginkgo.Fail(failure.Wrap("retry budget exhausted").Because(err))
+	default:
+		ginkgo.Fail(failure.Because(err))
+	}
+}
+
+func isNotFound(err error) bool {
+	var notFound *ccv3.NotFoundError
+	return errors.As(err, &notFound)
+}
+
+func (cf *CF) ccAPI() func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.TargetFailed, "Failed to target Cloud Foundry"), func(ctx context.Context) error {
+			_, err := cf.CC.Info(ctx)
+			return err
+		})
+	}
+}
+
+func (cf *CF) ccAuth(user, password string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.AuthFailed, "Failed to authenticate with target Cloud Foundry"), func(ctx context.Context) error {
+			return cf.CC.Login(ctx, user, password)
+		})
+	}
+}
+
+func (cf *CF) ccAuthClient(client, clientSecret string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.AuthFailed, "Failed to authenticate with target Cloud Foundry"), func(ctx context.Context) error {
+			return cf.CC.LoginClient(ctx, client, clientSecret)
+		})
+	}
+}
+
+func (cf *CF) ccTargetOrgAndSpace(org, space string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.TargetOrgFailed, "Failed to target test org").With("org", org).With("space", space), func(ctx context.Context) error {
+			organization, err := cf.CC.OrganizationByName(ctx, org)
+			if err != nil {
+				return err
+			}
+
+			targetSpace, err := cf.CC.SpaceByName(ctx, organization.GUID, space)
+			if err != nil {
+				return err
+			}
+
+			cf.CC.Target(organization.GUID, targetSpace.GUID)
+			return nil
+		})
+	}
+}
+
+func (cf *CF) spaceGUID() string {
+	_, spaceGUID := cf.CC.Targeted()
+	return spaceGUID
+}
+
+func (cf *CF) ccPush(appName string, args ...string) func() {
+	return func() {
+		opts, err := ccv3.ParsePushArgs(args)
+		if err != nil {
+			ginkgo.Fail(failreason.New(failreason.AppPushFailed, "Failed to push test app").With("app", appName).Wrap(err.Error()).String())
+		}
+
+		cf.ccDo(failreason.New(failreason.AppPushFailed, "Failed to push test app").With("app", appName), func(ctx context.Context) error {
+			_, err := cf.CC.Push(ctx, cf.spaceGUID(), appName, opts)
+			return err
+		})
+	}
+}
+
+func (cf *CF) ccStart(appName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.AppStartFailed, "Failed to start test app").With("app", appName), func(ctx context.Context) error {
+			app, err := cf.CC.AppByName(ctx, cf.spaceGUID(), appName)
+			if err != nil {
+				return err
+			}
+			return cf.CC.StartApp(ctx, app.GUID)
+		})
+	}
+}
+
+func (cf *CF) ccSetEnv(appName, name, value string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.AppEnvFailed, "Failed to set environment variable for test app").With("app", appName), func(ctx context.Context) error {
+			app, err := cf.CC.AppByName(ctx, cf.spaceGUID(), appName)
+			if err != nil {
+				return err
+			}
+			return cf.CC.SetAppEnv(ctx, app.GUID, map[string]string{name: value})
+		})
+	}
+}
+
+func (cf *CF) ccDelete(appName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.AppDeleteFailed, "Failed to delete test app").With("app", appName), func(ctx context.Context) error {
+			app, err := cf.CC.AppByName(ctx, cf.spaceGUID(), appName)
+			if isNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := cf.CC.DeleteAppRoutes(ctx, app.GUID); err != nil {
+				return err
+			}
+			return cf.CC.DeleteApp(ctx, app.GUID)
+		})
+	}
+}
+
+func (cf *CF) ccEnableServiceAccessForPlan(org, service, plan string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.ServiceAccessFailed, "Failed to enable service access for CF test org").With("org", org).With("service_offering", service).With("plan", plan), func(ctx context.Context) error {
+			organization, err := cf.CC.OrganizationByName(ctx, org)
+			if err != nil {
+				return err
+			}
+
+			servicePlan, err := cf.CC.ServicePlanByName(ctx, service, plan)
+			if err != nil {
+				return err
+			}
+
+			if err := cf.CC.DisableServicePlanForOrg(ctx, servicePlan.GUID, organization.GUID); err != nil {
+				return err
+			}
+			return cf.CC.EnableServicePlanForOrg(ctx, servicePlan.GUID, organization.GUID)
+		})
+	}
+}
+
+// quotaReachedMessages are broker responses meaning no instance of the plan
+// can be created, in which case the plan is skipped rather than failed. The
+// Cloud Controller returns them when the instance is requested from a
+// synchronous broker, and otherwise in its failed last operation.
+var quotaReachedMessages = []string{
+	"instance limit for this service has been reached",
+	"plan instance limit exceeded for service",
+	"global instance limit exceeded for service",
+}
+
+func (cf *CF) ccCreateService(serviceName, planName, instanceName string, skip *bool) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.ServiceCreateFailed, "Failed to create Redis service instance").With("service_instance", instanceName).With("plan", planName), func(ctx context.Context) error {
+			// an earlier attempt may have been accepted; any error other than
+			// the instance not existing must not lead to creating another
+			if _, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), instanceName); err == nil || !isNotFound(err) {
+				return err
+			}
+
+			servicePlan, err := cf.CC.ServicePlanByName(ctx, serviceName, planName)
+			if err != nil {
+				return err
+			}
+
+			err = cf.CC.CreateServiceInstance(ctx, cf.spaceGUID(), servicePlan.GUID, instanceName)
+			if err != nil && quotaReached(err) {
+				fmt.Printf("No Plan Instances available for testing %s plan\n", planName)
+				*skip = true
+				return nil
+			}
+			return err
+		})
+
+		if !(*skip) {
+			cf.awaitCreation(planName, instanceName, skip, failreason.New(failreason.ServiceCreateFailed, "Failed to create Redis service instance").With("service_instance", instanceName).With("plan", planName))
+		}
+	}
+}
+
+func quotaReached(err error) bool {
+	for _, message := range quotaReachedMessages {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *CF) ccUpdateService(serviceName, planName, instanceName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.PlanChangeFailed, "Failed to update service to plan").With("service_instance", instanceName).With("plan", planName), func(ctx context.Context) error {
+			instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), instanceName)
+			if err != nil {
+				return err
+			}
+
+			servicePlan, err := cf.CC.ServicePlanByName(ctx, serviceName, planName)
+			if err != nil {
+				return err
+			}
+
+			return cf.CC.UpdateServiceInstance(ctx, instance.GUID, ccv3.ServiceInstanceUpdate{
+				PlanGUID: servicePlan.GUID,
+			})
+		})
+
+		cf.awaitLastOperation(instanceName, "update", failreason.New(failreason.PlanChangeFailed, "Failed to update Redis service instance to plan").With("service_instance", instanceName).With("plan", planName))
+	}
+}
+
+func (cf *CF) ccUpdateServiceParameters(instanceName, parameters string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.ServiceUpdateFailed, "Failed to update service").With("service_instance", instanceName), func(ctx context.Context) error {
+			instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), instanceName)
+			if err != nil {
+				return err
+			}
+			return cf.CC.UpdateServiceInstance(ctx, instance.GUID, ccv3.ServiceInstanceUpdate{
+				Parameters: json.RawMessage(parameters),
+			})
+		})
+
+		cf.awaitLastOperation(instanceName, "update", failreason.New(failreason.ServiceUpdateFailed, "Failed to update Redis service instance").With("service_instance", instanceName))
+	}
+}
+
+func (cf *CF) ccDeleteService(instanceName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.ServiceDeleteFailed, "Failed to delete service").With("service_instance", instanceName), func(ctx context.Context) error {
+			instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), instanceName)
+			if isNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return cf.CC.DeleteServiceInstance(ctx, instance.GUID)
+		})
+	}
+}
+
+func (cf *CF) ccBindService(appName, instanceName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.BindFailed, "Failed to bind Redis service instance to test app").With("app", appName).With("service_instance", instanceName), func(ctx context.Context) error {
+			app, instance, err := cf.ccAppAndInstance(ctx, appName, instanceName)
+			if err != nil {
+				return err
+			}
+
+			bindings, err := cf.CC.CredentialBindings(ctx, instance.GUID, "app", app.GUID)
+			if err != nil || len(bindings) > 0 {
+				return err
+			}
+			return cf.CC.CreateAppBinding(ctx, instance.GUID, app.GUID)
+		})
+	}
+}
+
+func (cf *CF) ccUnbindService(appName, instanceName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.UnbindFailed, "Failed to unbind service instance from app").With("app", appName).With("service_instance", instanceName), func(ctx context.Context) error {
+			app, instance, err := cf.ccAppAndInstance(ctx, appName, instanceName)
+			if isNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			bindings, err := cf.CC.CredentialBindings(ctx, instance.GUID, "app", app.GUID)
+			if err != nil {
+				return err
+			}
+			for _, binding := range bindings {
+				if err := cf.CC.DeleteCredentialBinding(ctx, binding.GUID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func (cf *CF) ccAppAndInstance(ctx context.Context, appName, instanceName string) (ccv3.App, ccv3.ServiceInstance, error) {
+	app, err := cf.CC.AppByName(ctx, cf.spaceGUID(), appName)
+	if err != nil {
+		return app, ccv3.ServiceInstance{}, err
+	}
+
+	instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), instanceName)
+	return app, instance, err
+}
+
+func (cf *CF) ccCreateServiceKey(serviceInstanceName, serviceKeyName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.ServiceKeyCreateFailed, "Failed to create service key for Redis service instance").With("service_instance", serviceInstanceName).With("service_key", serviceKeyName), func(ctx context.Context) error {
+			instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), serviceInstanceName)
+			if err != nil {
+				return err
+			}
+
+			if _, err := cf.ccServiceKey(ctx, instance.GUID, serviceKeyName); err == nil || !isNotFound(err) {
+				return err
+			}
+			return cf.CC.CreateServiceKey(ctx, instance.GUID, serviceKeyName)
+		})
+	}
+}
+
+func (cf *CF) ccDeleteServiceKey(serviceInstanceName, serviceKeyName string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.ServiceKeyDeleteFailed, "Failed to delete service key for Redis service instance").With("service_instance", serviceInstanceName).With("service_key", serviceKeyName), func(ctx context.Context) error {
+			instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), serviceInstanceName)
+			if isNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			key, err := cf.ccServiceKey(ctx, instance.GUID, serviceKeyName)
+			if isNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return cf.CC.DeleteCredentialBinding(ctx, key.GUID)
+		})
+	}
+}
+
+func (cf *CF) ccServiceKey(ctx context.Context, instanceGUID, serviceKeyName string) (ccv3.CredentialBinding, error) {
+	keys, err := cf.CC.CredentialBindings(ctx, instanceGUID, "key", "")
+	if err != nil {
+		return ccv3.CredentialBinding{}, err
+	}
+
+	for _, key := range keys {
+		if key.Name == serviceKeyName {
+			return key, nil
+		}
+	}
+	return ccv3.CredentialBinding{}, &ccv3.NotFoundError{Resource: "Service key", Name: serviceKeyName}
+}
+
+// ccServiceKeyCredentials reads the credentials of the instance's only service key
+func (cf *CF) ccServiceKeyCredentials(serviceInstanceName string) Credentials {
+	var credentials Credentials
+
+	cf.ccDo(failreason.New(failreason.ServiceKeyFetchFailed, "Failed to retrieve service key for Redis service instance").With("service_instance", serviceInstanceName), func(ctx context.Context) error {
+		instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), serviceInstanceName)
+		if err != nil {
+			return err
+		}
+
+		keys, err := cf.CC.CredentialBindings(ctx, instance.GUID, "key", "")
+		if err != nil {
+			return err
+		}
+		if len(keys) != 1 {
+			return fmt.Errorf("expected exactly one service key for %s, found %d", serviceInstanceName, len(keys))
+		}
+
+		details, err := cf.CC.CredentialBindingDetails(ctx, keys[0].GUID)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(details, &credentials); err != nil {
+			return err
+		}
+
+		if credentials.Host == "" || credentials.Port == 0 {
+			return fmt.Errorf("invalid service key for %s, missing host or port", serviceInstanceName)
+		}
+		return nil
+	})
+
+	return credentials
+}
+
+func (cf *CF) ccCreateAndBindSecurityGroup(securityGroup, serviceName string) func() {
+	return func() {
+		destination, ports := cf.securityGroupDestination(cf.ccServiceKeyCredentials(serviceName))
+
+		cf.ccDo(failreason.New(failreason.SecurityGroupCreateFailed, "Failed to create security group").With("security_group", securityGroup), func(ctx context.Context) error {
+			if _, err := cf.CC.SecurityGroupByName(ctx, securityGroup); err == nil || !isNotFound(err) {
+				return err
+			}
+
+			rules := []ccv3.SecurityGroupRule{{Protocol: "tcp", Destination: destination, Ports: ports}}
+			_, err := cf.CC.CreateSecurityGroup(ctx, securityGroup, rules)
+			return err
+		})
+
+		cf.ccDo(failreason.New(failreason.SecurityGroupBindFailed, "Failed to bind security group to space").With("security_group", securityGroup), func(ctx context.Context) error {
+			group, err := cf.CC.SecurityGroupByName(ctx, securityGroup)
+			if err != nil {
+				return err
+			}
+			return cf.CC.BindSecurityGroupToSpace(ctx, group.GUID, cf.spaceGUID())
+		})
+	}
+}
+
+func (cf *CF) ccDeleteSecurityGroup(securityGroup string) func() {
+	return func() {
+		cf.ccDo(failreason.New(failreason.SecurityGroupDeleteFailed, "Failed to delete security group").With("security_group", securityGroup), func(ctx context.Context) error {
+			group, err := cf.CC.SecurityGroupByName(ctx, securityGroup)
+			if isNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return cf.CC.DeleteSecurityGroup(ctx, group.GUID)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package cf_test
+
+import (
+	"context"
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeCloudController provisions service instances asynchronously, like a
+// Cloud Controller in front of an on-demand broker. Methods the tests do not
+// use panic through the nil embedded interface.
+type fakeCloudController struct {
+	smokeTestCF.CloudController
+
+	created       bool
+	lastOperation ccv3.LastOperation
+}
+
+func (cc *fakeCloudController) Targeted() (string, string) {
+	return "org-guid", "space-guid"
+}
+
+func (cc *fakeCloudController) ServicePlanByName(ctx context.Context, offering, plan string) (ccv3.ServicePlan, error) {
+	return ccv3.ServicePlan{GUID: "plan-guid"}, nil
+}
+
+func (cc *fakeCloudController) CreateServiceInstance(ctx context.Context, spaceGUID, planGUID, name string) error {
+	cc.created = true
+	return nil
+}
+
+func (cc *fakeCloudController) ServiceInstanceByName(ctx context.Context, spaceGUID, name string) (ccv3.ServiceInstance, error) {
+	if !cc.created {
+		return ccv3.ServiceInstance{}, &ccv3.NotFoundError{Resource: "Service instance", Name: name}
+	}
+	return ccv3.ServiceInstance{GUID: "instance-guid", Name: name, LastOperation: cc.lastOperation}, nil
+}
+
+var _ = Describe("CF backed by the Cloud Controller API", func() {
+	var (
+		cc     *fakeCloudController
+		testCF smokeTestCF.CF
+	)
+
+	BeforeEach(func() {
+		cc = new(fakeCloudController)
+		testCF = smokeTestCF.CF{
+			ShortTimeout:          time.Second,
+			LongTimeout:           time.Second,
+			AsyncOperationTimeout: time.Second,
+			AsyncPollInterval:     time.Millisecond,
+			CC:                    cc,
+		}
+	})
+
+	Describe("CreateService", func() {
+		It("skips the plan when the broker refuses the instance asynchronously because the plan is at its quota", func() {
+			cc.lastOperation = ccv3.LastOperation{
+				Type:        "create",
+				State:       "failed",
+				Description: "Service broker error: plan instance limit exceeded for service ID: redis-odb",
+			}
+
+			var skip bool
+			testCF.CreateService("p.redis", "cache-small", "instance", &skip)()
+
+			Expect(cc.created).To(BeTrue())
+			Expect(skip).To(BeTrue())
+		})
+
+		It("does not skip the plan once the instance is created", func() {
+			cc.lastOperation = ccv3.LastOperation{Type: "create", State: "succeeded"}
+
+			var skip bool
+			testCF.CreateService("p.redis", "cache-small", "instance", &skip)()
+
+			Expect(skip).To(BeFalse())
+		})
+	})
+})
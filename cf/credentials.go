@@ -0,0 +1,90 @@
+package cf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Credentials are the contents of a Redis service key
+type Credentials struct {
+	Host         string   `json:"host"`
+	Port         int      `json:"port"`
+	Password     string   `json:"password"`
+	TLS_Port     int      `json:"tls_port"`
+	TLS_Versions []string `json:"tls_versions"`
+	TLS_CA_Cert  string   `json:"tls_ca_cert"`
+
+	// Sentinels and Master_Name are set for instances fronted by Redis Sentinel
+	Sentinels   []Endpoint `json:"sentinels"`
+	Master_Name string     `json:"master_name"`
+
+	// Cluster_Nodes is set for instances running Redis Cluster
+	Cluster_Nodes []Endpoint `json:"cluster_nodes"`
+
+	// Extra holds every field of the key not captured above
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (c *Credentials) UnmarshalJSON(data []byte) error {
+	type credentials Credentials
+	if err := json.Unmarshal(data, (*credentials)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for _, known := range []string{
+		"host", "port", "password", "tls_port", "tls_versions", "tls_ca_cert",
+		"sentinels", "master_name", "cluster_nodes",
+	} {
+		delete(fields, known)
+	}
+
+	c.Extra = nil
+	if len(fields) > 0 {
+		c.Extra = fields
+	}
+	return nil
+}
+
+// Endpoint is a host and port, given in a service key either as an object or
+// as a "host:port" string
+type Endpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var address string
+	if err := json.Unmarshal(data, &address); err != nil {
+		type endpoint Endpoint
+		if err := json.Unmarshal(data, (*endpoint)(e)); err != nil {
+			return err
+		}
+		if e.Port == 0 {
+			return fmt.Errorf("endpoint %s has no port", data)
+		}
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	e.Host = host
+	e.Port, err = strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid port in endpoint %q", address)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cf_test
+
+import (
+	"encoding/json"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credentials", func() {
+	parse := func(key string) (smokeTestCF.Credentials, error) {
+		var credentials smokeTestCF.Credentials
+		err := json.Unmarshal([]byte(key), &credentials)
+		return credentials, err
+	}
+
+	It("reads the plain and TLS ports", func() {
+		credentials, err := parse(`{"host": "10.0.0.1", "port": 6379, "password": "secret", "tls_port": 16379, "tls_versions": ["tlsv1.2"]}`)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials.Host).To(Equal("10.0.0.1"))
+		Expect(credentials.Port).To(Equal(6379))
+		Expect(credentials.TLS_Port).To(Equal(16379))
+		Expect(credentials.TLS_Versions).To(Equal([]string{"tlsv1.2"}))
+		Expect(credentials.Extra).To(BeNil())
+	})
+
+	It("leaves the TLS port unset for keys without TLS", func() {
+		credentials, err := parse(`{"host": "10.0.0.1", "port": 6379, "password": "secret"}`)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials.TLS_Port).To(BeZero())
+	})
+
+	It("keeps unknown fields in Extra", func() {
+		credentials, err := parse(`{"host": "10.0.0.1", "port": 6379, "uri": "redis://10.0.0.1:6379", "db": 0}`)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials.Extra).To(HaveLen(2))
+		Expect(string(credentials.Extra["uri"])).To(Equal(`"redis://10.0.0.1:6379"`))
+		Expect(string(credentials.Extra["db"])).To(Equal(`0`))
+	})
+
+	It("rejects a non-numeric port", func() {
+		_, err := parse(`{"host": "10.0.0.1", "port": "6379"}`)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("endpoints", func() {
+		for _, c := range []struct {
+			description string
+			endpoint    string
+			expected    smokeTestCF.Endpoint
+		}{
+			{"an object", `{"host": "10.0.0.2", "port": 26379}`, smokeTestCF.Endpoint{Host: "10.0.0.2", Port: 26379}},
+			{"a host:port string", `"10.0.0.2:26379"`, smokeTestCF.Endpoint{Host: "10.0.0.2", Port: 26379}},
+			{"a host:port string with an IPv6 host", `"[fd00::2]:26379"`, smokeTestCF.Endpoint{Host: "fd00::2", Port: 26379}},
+		} {
+			c := c
+			It("reads "+c.description, func() {
+				credentials, err := parse(`{"host": "10.0.0.1", "port": 6379, "master_name": "primary", "sentinels": [` + c.endpoint + `], "cluster_nodes": [` + c.endpoint + `]}`)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(credentials.Master_Name).To(Equal("primary"))
+				Expect(credentials.Sentinels).To(Equal([]smokeTestCF.Endpoint{c.expected}))
+				Expect(credentials.Cluster_Nodes).To(Equal([]smokeTestCF.Endpoint{c.expected}))
+				Expect(credentials.Extra).To(BeNil())
+			})
+		}
+
+		for _, c := range []struct {
+			description string
+			endpoint    string
+		}{
+			{"a string without a port", `"10.0.0.2"`},
+			{"a string with a non-numeric port", `"10.0.0.2:sentinel"`},
+			{"an object without a port", `{"host": "10.0.0.2"}`},
+			{"an object with a non-numeric port", `{"host": "10.0.0.2", "port": "26379"}`},
+		} {
+			c := c
+			It("rejects "+c.description, func() {
+				_, err := parse(`{"host": "10.0.0.1", "port": 6379, "sentinels": [` + c.endpoint + `]}`)
+
+				Expect(err).To(HaveOccurred())
+			})
+		}
+
+		It("formats as host:port", func() {
+			Expect(smokeTestCF.Endpoint{Host: "fd00::2", Port: 26379}.String()).To(Equal("[fd00::2]:26379"))
+		})
+	})
+})
@@ -0,0 +1,62 @@
+package cf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/onsi/gomega/gexec"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// fatalErrors are cf CLI failures that no amount of retrying will fix, so the
+// operation fails straight away. Anything not listed here, such as 5xx
+// responses from the Cloud Controller, timeouts and network errors, is retried.
+var fatalErrors = []retry.Abort{
+	fatalError(`Credentials were rejected|Bad credentials|[Ii]nvalid client credentials`, failreason.InvalidCredentials, "Invalid credentials for target Cloud Foundry"),
+	fatalError(`Not logged in\.`, failreason.NotLoggedIn, "Not logged in to target Cloud Foundry"),
+	fatalError(`No API endpoint set`, failreason.NoAPIEndpoint, "No Cloud Foundry API endpoint targeted"),
+	fatalError(`Service offering '?[^' ]+'? not found`, failreason.ServiceOfferingNotFound, "Service offering not found"),
+	fatalError(`[Tt]he plan '?[^' ]+'? could not be found|Service plan '?[^' ]+'? not found|[Pp]lan '?[^' ]+'? does not exist`, failreason.ServicePlanNotFound, "Service plan does not exist"),
+	fatalError(`Organization '?[^' ]+'? not found`, failreason.OrgNotFound, "Organization not found"),
+	fatalError(`Space '?[^' ]+'? not found`, failreason.SpaceNotFound, "Space not found"),
+	fatalError(`Incorrect Usage`, failreason.IncorrectUsage, "Incorrect cf CLI usage"),
+	fatalError(quotaExceededPattern, failreason.QuotaReached, "Org or space quota reached"),
+}
+
+// quotaExceededPattern is the Cloud Controller refusing to create a resource
+// because the org's or space's quota is used up. A broker's own instance limit
+// is not matched, since that skips the plan instead.
+const quotaExceededPattern = `You have exceeded (your|the) .*(limit|quota)|[Qq]uota (has been )?exceeded`
+
+var quotaExceeded = regexp.MustCompile(quotaExceededPattern)
+
+// planChangeRejected is the broker or Cloud Controller refusing a plan change,
+// which no retry will get past
+var planChangeRejected = fatalError(
+	`does not support changing plans|[Pp]lan change .*not (permitted|allowed|supported)|cannot (be )?(updated?|changed?) to plan`,
+	failreason.PlanChangeRejected,
+	"Broker rejected the plan change",
+)
+
+// fatalError aborts with reason when a failed cf command printed a line
+// matching pattern, adding that line to the reason
+func fatalError(pattern string, code failreason.Code, reason string) retry.Abort {
+	regex := regexp.MustCompile(pattern)
+
+	return func(session *gexec.Session) (string, bool) {
+		if session.ExitCode() == 0 {
+			return "", false
+		}
+
+		for _, output := range [][]byte{session.Err.Contents(), session.Out.Contents()} {
+			for _, line := range strings.Split(string(output), "\n") {
+				if regex.MatchString(line) {
+					return failreason.New(code, reason).Wrap(line).String(), true
+				}
+			}
+		}
+
+		return "", false
+	}
+}
@@ -0,0 +1,203 @@
+package cf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	helpersCF "github.com/cloudfoundry-incubator/cf-test-helpers/cf"
+	"github.com/onsi/gomega/gexec"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// LastOperationFailedError is returned when the broker reports that an
+// asynchronous operation on a service instance failed
+type LastOperationFailedError struct {
+	Instance      string
+	LastOperation ccv3.LastOperation
+}
+
+func (e *LastOperationFailedError) Error() string {
+	return fmt.Sprintf("%s of service instance %s failed: %s", e.LastOperation.Type, e.Instance, e.LastOperation.Description)
+}
+
+// defaultAsyncPollInterval is how often an async operation is polled when
+// AsyncPollInterval is not set
+const defaultAsyncPollInterval = 5 * time.Second
+
+// asyncPolicy polls at a fixed interval until the async operation timeout
+// runs out rather than for a number of retries, since brokers can take many
+// minutes
+func (cf *CF) asyncPolicy() retry.Policy {
+	timeout := cf.AsyncOperationTimeout
+	if timeout == 0 {
+		timeout = cf.LongTimeout
+	}
+
+	interval := cf.AsyncPollInterval
+	if interval <= 0 {
+		interval = defaultAsyncPollInterval
+	}
+
+	return retry.Policy{
+		SessionTimeout: cf.ShortTimeout,
+		Backoff:        retry.None(interval),
+		MaxRetries:     math.MaxInt32,
+		Budget:         timeout,
+		Breaker:        cf.Breaker,
+		Classifier:     lastOperationFatal,
+		Observers:      cf.observers(),
+	}
+}
+
+// lastOperationFatal stops polling as soon as the broker reports failure
+func lastOperationFatal(result interface{}, err error) (string, bool) {
+	var failed *LastOperationFailedError
+	if errors.As(err, &failed) {
+		return failed.LastOperation.Description, true
+	}
+	return ccFatal(result, err)
+}
+
+// awaitLastOperation waits until the instance's last operation is an
+// operationType that has succeeded
+func (cf *CF) awaitLastOperation(instanceName, operationType string, failure failreason.Failure) {
+	failOperation(failure, cf.pollLastOperation(instanceName, operationType))
+}
+
+// awaitCreation waits for the instance to be created. Brokers that provision
+// asynchronously only report that a plan is at its quota in the failed last
+// operation, in which case the plan is skipped rather than failed.
+func (cf *CF) awaitCreation(planName, instanceName string, skip *bool, failure failreason.Failure) {
+	err := cf.pollLastOperation(instanceName, "create")
+	if err != nil && quotaReached(err) {
+		fmt.Printf("No Plan Instances available for testing %s plan\n", planName)
+		*skip = true
+		return
+	}
+	failOperation(failure, err)
+}
+
+func (cf *CF) pollLastOperation(instanceName, operationType string) error {
+	poll := func(ctx context.Context) (interface{}, error) {
+		lastOperation, err := cf.lastOperation(ctx, instanceName)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Service instance %s: %s %s\n", instanceName, lastOperation.Type, lastOperation.State)
+		if lastOperation.State == "failed" {
+			return lastOperation, &LastOperationFailedError{Instance: instanceName, LastOperation: lastOperation}
+		}
+		return lastOperation, nil
+	}
+
+	succeeded := func(result interface{}, err error) bool {
+		if err != nil {
+			return false
+		}
+		lastOperation := result.(ccv3.LastOperation)
+		return lastOperation.Type == operationType && lastOperation.State == "succeeded"
+	}
+
+	_, err := cf.asyncPolicy().Do(context.Background(), poll, succeeded)
+	return err
+}
+
+// awaitDeletion waits until the instance no longer exists
+func (cf *CF) awaitDeletion(instanceName string, failure failreason.Failure) {
+	poll := func(ctx context.Context) (interface{}, error) {
+		lastOperation, err := cf.lastOperation(ctx, instanceName)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Service instance %s: %s %s\n", instanceName, lastOperation.Type, lastOperation.State)
+		if lastOperation.Type == "delete" && lastOperation.State == "failed" {
+			return lastOperation, &LastOperationFailedError{Instance: instanceName, LastOperation: lastOperation}
+		}
+		return lastOperation, fmt.Errorf("service instance %s still exists", instanceName)
+	}
+
+	gone := func(result interface{}, err error) bool {
+		return isNotFound(err)
+	}
+
+	_, err := cf.asyncPolicy().Do(context.Background(), poll, gone)
+	failOperation(failure, err)
+}
+
+// lastOperation reads the instance's last operation, returning a
+// *ccv3.NotFoundError once the instance does not exist
+func (cf *CF) lastOperation(ctx context.Context, instanceName string) (ccv3.LastOperation, error) {
+	if cf.CC != nil {
+		instance, err := cf.CC.ServiceInstanceByName(ctx, cf.spaceGUID(), instanceName)
+		return instance.LastOperation, err
+	}
+
+	notFound := &ccv3.NotFoundError{Resource: "Service instance", Name: instanceName}
+
+	session, err := cf.run(ctx, "service", instanceName, "--guid")
+	if err != nil {
+		if strings.Contains(string(session.Out.Contents())+string(session.Err.Contents()), "not found") {
+			return ccv3.LastOperation{}, notFound
+		}
+		return ccv3.LastOperation{}, err
+	}
+	guid := strings.TrimSpace(string(session.Out.Contents()))
+
+	session, err = cf.run(ctx, "curl", "/v3/service_instances/"+guid)
+	if err != nil {
+		return ccv3.LastOperation{}, err
+	}
+
+	var instance struct {
+		LastOperation ccv3.LastOperation `json:"last_operation"`
+		Errors        []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(session.Out.Contents(), &instance); err != nil {
+		return ccv3.LastOperation{}, fmt.Errorf("decoding service instance %s: %s", instanceName, err)
+	}
+
+	if len(instance.Errors) > 0 {
+		if instance.Errors[0].Title == "CF-ResourceNotFound" {
+			return ccv3.LastOperation{}, notFound
+		}
+		return ccv3.LastOperation{}, fmt.Errorf("%s: %s", instance.Errors[0].Title, instance.Errors[0].Detail)
+	}
+
+	return instance.LastOperation, nil
+}
+
+// run runs a cf command to completion, killing it when ctx is done or
+// ShortTimeout passes, and returns an error if it did not exit successfully
+func (cf *CF) run(ctx context.Context, args ...string) (*gexec.Session, error) {
+	session := helpersCF.Cf(args...)
+
+	timer := time.NewTimer(cf.ShortTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-session.Exited:
+	case <-timer.C:
+		session.Kill()
+		<-session.Exited
+	case <-ctx.Done():
+		session.Kill()
+		<-session.Exited
+	}
+
+	if session.ExitCode() != 0 {
+		return session, fmt.Errorf("cf %s exited with %d: %s", args[0], session.ExitCode(), strings.TrimSpace(string(session.Err.Contents())))
+	}
+	return session, nil
+}
@@ -0,0 +1,159 @@
+// Package failreason describes why a smoke test failed in a form that both
+// people and the reporter can read. A Failure is written as the first line of
+// a ginkgo failure message, encoded as JSON with the FailReason key the smoke
+// tests have always used, and decoded again by the reporter.
+package failreason
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DocsURL is the smoke test troubleshooting guide
+const DocsURL = "https://docs.pivotal.io/redis/smoke-tests.html"
+
+// Code identifies a kind of failure. Codes are stable so that reports can be
+// matched on them.
+type Code string
+
+const (
+	InvalidConfig Code = "invalid-config"
+
+	CloudControllerUnavailable Code = "cloud-controller-unavailable"
+	TargetFailed               Code = "target-failed"
+	AuthFailed                 Code = "auth-failed"
+	InvalidCredentials         Code = "invalid-credentials"
+	NotLoggedIn                Code = "not-logged-in"
+	NoAPIEndpoint              Code = "no-api-endpoint"
+	IncorrectUsage             Code = "incorrect-cf-usage"
+	LogoutFailed               Code = "logout-failed"
+
+	QuotaCreateFailed Code = "quota-create-failed"
+	QuotaReached      Code = "quota-reached"
+	OrgCreateFailed   Code = "org-create-failed"
+	OrgDeleteFailed   Code = "org-delete-failed"
+	OrgNotFound       Code = "org-not-found"
+	TargetOrgFailed   Code = "target-org-failed"
+	SpaceCreateFailed Code = "space-create-failed"
+	SpaceNotFound     Code = "space-not-found"
+	UserCreateFailed  Code = "user-create-failed"
+	UserDeleteFailed  Code = "user-delete-failed"
+	SpaceRoleFailed   Code = "space-role-failed"
+
+	SecurityGroupCreateFailed Code = "security-group-create-failed"
+	SecurityGroupBindFailed   Code = "security-group-bind-failed"
+	SecurityGroupDeleteFailed Code = "security-group-delete-failed"
+
+	ServiceAccessFailed     Code = "service-access-failed"
+	ServiceOfferingNotFound Code = "service-offering-not-found"
+	ServicePlanNotFound     Code = "service-plan-not-found"
+	ServiceCreateFailed     Code = "service-create-failed"
+	ServiceUpdateFailed     Code = "service-update-failed"
+	ServiceDeleteFailed     Code = "service-delete-failed"
+	ServiceCleanupFailed    Code = "service-cleanup-failed"
+	PlanChangeFailed        Code = "plan-change-failed"
+	PlanChangeRejected      Code = "plan-change-rejected"
+	ServiceKeyCreateFailed  Code = "service-key-create-failed"
+	ServiceKeyDeleteFailed  Code = "service-key-delete-failed"
+	ServiceKeyFetchFailed   Code = "service-key-fetch-failed"
+	ServiceKeyInvalid       Code = "service-key-invalid"
+
+	AppPushFailed    Code = "app-push-failed"
+	AppStartFailed   Code = "app-start-failed"
+	AppEnvFailed     Code = "app-env-failed"
+	AppDeleteFailed  Code = "app-delete-failed"
+	BindFailed       Code = "bind-failed"
+	UnbindFailed     Code = "unbind-failed"
+	AppNotResponding Code = "app-not-responding"
+	AppWriteFailed   Code = "app-write-failed"
+	AppReadFailed    Code = "app-read-failed"
+
+	RedisUnreachable           Code = "redis-unreachable"
+	RedisWriteFailed           Code = "redis-write-failed"
+	RedisReadFailed            Code = "redis-read-failed"
+	RedisDeleteFailed          Code = "redis-delete-failed"
+	IsolationBreached          Code = "isolation-breached"
+	PasswordMissing            Code = "password-missing"
+	AuthMisconfigured          Code = "auth-misconfigured"
+	TLSProbeFailed             Code = "tls-probe-failed"
+	TLSMismatch                Code = "tls-mismatch"
+	DataTypeFailed             Code = "data-type-failed"
+	CommandPolicyViolated      Code = "command-policy-violated"
+	DataLost                   Code = "data-lost"
+	MemoryConfigMismatch       Code = "memory-config-mismatch"
+	EvictionMisbehaved         Code = "eviction-misbehaved"
+	BenchmarkFailed            Code = "benchmark-failed"
+	BenchmarkThresholdBreached Code = "benchmark-threshold-breached"
+)
+
+// Resource names something a failure involved, such as a service instance
+type Resource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Failure is why a step failed
+type Failure struct {
+	Code      Code       `json:"code,omitempty"`
+	Reason    string     `json:"FailReason"`
+	DocsURL   string     `json:"docs_url,omitempty"`
+	Resources []Resource `json:"resources,omitempty"`
+}
+
+// New creates a Failure with a reason formatted from format and args, linking
+// to the troubleshooting guide
+func New(code Code, format string, args ...interface{}) Failure {
+	return Failure{Code: code, Reason: fmt.Sprintf(format, args...), DocsURL: DocsURL}
+}
+
+// With returns a copy of the Failure naming a resource of kind it involved
+func (f Failure) With(kind, name string) Failure {
+	f.Resources = append(append([]Resource(nil), f.Resources...), Resource{Kind: kind, Name: name})
+	return f
+}
+
+// Wrap returns a copy of the Failure with detail appended to its reason, for
+// causes that are short enough to belong in it
+func (f Failure) Wrap(detail string) Failure {
+	f.Reason = fmt.Sprintf("%s: %s", f.Reason, strings.Join(strings.Fields(detail), " "))
+	return f
+}
+
+// String encodes the Failure as a single line of JSON
+func (f Failure) String() string {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	// a Failure only holds strings, so encoding cannot fail
+	encoder.Encode(f)
+	return strings.TrimSuffix(encoded.String(), "\n")
+}
+
+// Because formats a failure message: the encoded Failure followed by the
+// error that caused it
+func (f Failure) Because(err interface{}) string {
+	return fmt.Sprintf("%s\n%v", f, err)
+}
+
+// Parse finds the Failure in a failure message. Gomega may put other text
+// before the description it was given, so the first line that decodes as a
+// Failure with a reason is used.
+func Parse(message string) (Failure, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	scanner.Buffer(nil, len(message)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var f Failure
+		if err := json.Unmarshal([]byte(line), &f); err == nil && f.Reason != "" {
+			return f, true
+		}
+	}
+	return Failure{}, false
+}
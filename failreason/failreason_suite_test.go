@@ -0,0 +1,13 @@
+package failreason_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFailReason(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FailReason Suite")
+}
@@ -0,0 +1,75 @@
+package failreason_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+var _ = Describe("Failure", func() {
+	It("round-trips through a failure message", func() {
+		f := failreason.New(failreason.ServiceDeleteFailed, "Failed to delete service").
+			With("service_instance", `redis "primary"`)
+
+		parsed, ok := failreason.Parse(f.Because(errors.New("exceeded 10 retries")))
+
+		Expect(ok).To(BeTrue())
+		Expect(parsed).To(Equal(f))
+		Expect(parsed.Resources).To(ConsistOf(failreason.Resource{Kind: "service_instance", Name: `redis "primary"`}))
+		Expect(parsed.DocsURL).To(Equal(failreason.DocsURL))
+	})
+
+	It("keeps the FailReason key on the first line", func() {
+		message := failreason.New(failreason.OrgCreateFailed, "Failed to create org").Because("exit status 1")
+
+		Expect(message).To(HavePrefix(`{"code":"org-create-failed","FailReason":"Failed to create org",`))
+		Expect(message).To(HaveSuffix("}\nexit status 1"))
+	})
+
+	It("formats the reason", func() {
+		Expect(failreason.New(failreason.AppReadFailed, "Failed to get %s", "key").Reason).To(Equal("Failed to get key"))
+	})
+
+	It("appends detail to the reason on a single line", func() {
+		f := failreason.New(failreason.PlanChangeFailed, "Failed to update service").Wrap("plan\n  not found")
+
+		Expect(f.Reason).To(Equal("Failed to update service: plan not found"))
+	})
+
+	It("does not share resources between copies", func() {
+		base := failreason.New(failreason.BindFailed, "Failed to bind").With("app", "a")
+		first := base.With("service_instance", "one")
+		second := base.With("service_instance", "two")
+
+		Expect(first.Resources[1].Name).To(Equal("one"))
+		Expect(second.Resources[1].Name).To(Equal("two"))
+	})
+
+	Describe("Parse", func() {
+		It("finds the failure after text that Gomega puts before it", func() {
+			message := "Timed out after 10.000s.\n" + failreason.New(failreason.AppNotResponding, "Test app did not respond").String() + "\nExpected true"
+
+			f, ok := failreason.Parse(message)
+
+			Expect(ok).To(BeTrue())
+			Expect(f.Code).To(Equal(failreason.AppNotResponding))
+		})
+
+		It("reads the hand-written form", func() {
+			f, ok := failreason.Parse("{\"FailReason\": \"Failed to create org\"}\nexit status 1")
+
+			Expect(ok).To(BeTrue())
+			Expect(f.Reason).To(Equal("Failed to create org"))
+			Expect(f.Code).To(BeEmpty())
+		})
+
+		It("reports messages without a failure", func() {
+			_, ok := failreason.Parse("Expected\n    <bool>: false\nto be true\n{not json}")
+
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
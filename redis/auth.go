@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/pborman/uuid"
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// AssertRequiresPassword checks that the instance refuses commands from
+// clients with no password or a random password, and accepts the key's own
+// password, on the plain port and, when the key has one, the TLS port. It
+// runs on every plan, whereas AssertRejectsPassword needs a second instance.
+func (c *Client) AssertRequiresPassword() func() {
+	return func() {
+		if c.credentials.Password == "" {
+			c.failHandler(failreason.New(failreason.PasswordMissing, "Service key has no password, so the instance is open to anyone who can reach it").With("address", c.Address()).String())
+			return
+		}
+
+		c.assertAccess([]passwordAttempt{
+			{description: "no password"},
+			{description: "a random password", password: uuid.NewRandom().String()},
+			{description: "the service key password", password: c.credentials.Password, accept: true},
+		})
+	}
+}
+
+// AssertRejectsPassword checks that the valid password from another service
+// instance's key is refused, so instances do not share credentials
+func (c *Client) AssertRejectsPassword(other *smokeTestCF.Credentials) func() {
+	return func() {
+		c.assertAccess([]passwordAttempt{
+			{description: "another instance's password", password: other.Password},
+		})
+	}
+}
+
+type passwordAttempt struct {
+	description string
+	password    string
+	accept      bool
+}
+
+func (c *Client) assertAccess(attempts []passwordAttempt) {
+	clients := []*Client{c}
+	if c.credentials.TLS_Port > 0 {
+		clients = append(clients, c.TLS())
+	}
+
+	var unexpected []string
+	for _, client := range clients {
+		for _, attempt := range attempts {
+			accepted, reply, err := client.authenticate(attempt.password)
+			if err != nil {
+				c.failHandler(failreason.New(failreason.RedisUnreachable, "Failed to connect to Redis").With("address", client.Address()).Because(err))
+				return
+			}
+
+			fmt.Printf("Connecting to %s with %s: %s\n", client.Address(), attempt.description, reply)
+			switch {
+			case accepted && !attempt.accept:
+				unexpected = append(unexpected, fmt.Sprintf("accepted %s on %s", attempt.description, client.Address()))
+			case !accepted && attempt.accept:
+				unexpected = append(unexpected, fmt.Sprintf("refused %s on %s", attempt.description, client.Address()))
+			}
+		}
+	}
+
+	if len(unexpected) > 0 {
+		c.failHandler(failreason.New(failreason.AuthMisconfigured, "Redis authentication is misconfigured: %s", strings.Join(unexpected, ", ")).With("address", c.Address()).String())
+	}
+}
+
+// authenticate connects, sends AUTH unless password is empty, and reports
+// whether a following PING is answered. An open instance answers PING even
+// when AUTH itself errors, so only the PING decides.
+func (c *Client) authenticate(password string) (accepted bool, reply string, err error) {
+	err = c.retry(func(ctx context.Context) error {
+		var tlsConfig *tls.Config
+		if c.tls {
+			var err error
+			if tlsConfig, err = c.TLSConfig(); err != nil {
+				return err
+			}
+		}
+
+		conn, err := Dial(ctx, c.Address(), tlsConfig)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if password != "" {
+			if _, err := conn.Do(ctx, "AUTH", password); err != nil {
+				if _, ok := err.(ReplyError); !ok {
+					return err
+				}
+			}
+		}
+
+		_, err = conn.Do(ctx, "PING")
+		if replyErr, ok := err.(ReplyError); ok {
+			accepted, reply = false, replyErr.Error()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		accepted, reply = true, "PONG"
+		return nil
+	})
+	return accepted, reply, err
+}
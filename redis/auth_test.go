@@ -0,0 +1,71 @@
+package redis_test
+
+import (
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authentication", func() {
+	var (
+		fake        *fakeRedis
+		credentials smokeTestCF.Credentials
+		client      *redis.Client
+		failures    []string
+	)
+
+	setup := func(serverPassword string) {
+		fake = newFakeRedis(serverPassword)
+		credentials = smokeTestCF.Credentials{Host: fake.host(), Port: fake.port(), Password: "secret"}
+		failures = nil
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	}
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("passes when only the service key password is accepted", func() {
+		setup("secret")
+
+		client.AssertRequiresPassword()()
+
+		Expect(failures).To(BeEmpty())
+	})
+
+	It("fails when the instance is open", func() {
+		setup("")
+		fake.handle("AUTH", func([]string) string {
+			return "-ERR AUTH <password> called without any password configured for the default user\r\n"
+		})
+
+		client.AssertRequiresPassword()()
+
+		Expect(failures).To(ConsistOf(haveFailure(failreason.AuthMisconfigured, MatchRegexp(
+			`^Redis authentication is misconfigured: accepted no password on 127\.0\.0\.1:\d+, accepted a random password on 127\.0\.0\.1:\d+$`,
+		))))
+	})
+
+	It("fails when the service key password is refused", func() {
+		setup("other")
+
+		client.AssertRequiresPassword()()
+
+		Expect(failures).To(ConsistOf(ContainSubstring("refused the service key password")))
+	})
+
+	It("fails when another instance's password is accepted", func() {
+		setup("secret")
+
+		client.AssertRejectsPassword(&smokeTestCF.Credentials{Password: "secret"})()
+
+		Expect(failures).To(ConsistOf(ContainSubstring("accepted another instance's password")))
+	})
+})
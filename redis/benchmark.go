@@ -0,0 +1,195 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// BenchmarkOptions bound the load a benchmark puts on an instance
+type BenchmarkOptions struct {
+	// Operations is the total number of commands, split evenly between SET and GET
+	Operations int
+	// Concurrency is the number of connections issuing commands at once
+	Concurrency int
+	// ValueSize is the size in bytes of each value written
+	ValueSize int
+}
+
+// BenchmarkThresholds fail a benchmark that is slower than they allow. Zero
+// values are not checked.
+type BenchmarkThresholds struct {
+	P50             time.Duration
+	P95             time.Duration
+	P99             time.Duration
+	MinOpsPerSecond float64
+}
+
+// BenchmarkResult is the latency distribution and throughput of a benchmark
+type BenchmarkResult struct {
+	Operations   int
+	Elapsed      time.Duration
+	P50          time.Duration
+	P95          time.Duration
+	P99          time.Duration
+	OpsPerSecond float64
+}
+
+// Metrics returns the result keyed by metric name, latencies in milliseconds
+func (r BenchmarkResult) Metrics() map[string]float64 {
+	return map[string]float64{
+		"p50_ms":         milliseconds(r.P50),
+		"p95_ms":         milliseconds(r.P95),
+		"p99_ms":         milliseconds(r.P99),
+		"ops_per_second": r.OpsPerSecond,
+	}
+}
+
+func (r BenchmarkResult) String() string {
+	return fmt.Sprintf("%d operations in %s, %.0f ops/sec, p50 %s, p95 %s, p99 %s",
+		r.Operations, r.Elapsed.Round(time.Millisecond), r.OpsPerSecond, r.P50, r.P95, r.P99)
+}
+
+// Benchmark runs options.Operations alternating SET and GET commands over
+// options.Concurrency connections, storing the outcome in result, and fails
+// if it breaches thresholds
+func (c *Client) Benchmark(options BenchmarkOptions, thresholds BenchmarkThresholds, result *BenchmarkResult) func() {
+	return func() {
+		err := c.retry(func(ctx context.Context) error {
+			var err error
+			*result, err = c.benchmark(ctx, options)
+			return err
+		})
+		if err != nil {
+			c.failHandler(failreason.New(failreason.BenchmarkFailed, "Failed to benchmark Redis").With("address", c.Address()).Because(err))
+			return
+		}
+
+		fmt.Printf("Benchmarked %s: %s\n", c.Address(), result)
+		if breaches := thresholds.breaches(*result); len(breaches) > 0 {
+			c.failHandler(failreason.New(failreason.BenchmarkThresholdBreached, "Redis benchmark breached its thresholds: %s", strings.Join(breaches, ", ")).With("address", c.Address()).String())
+		}
+	}
+}
+
+func (c *Client) benchmark(ctx context.Context, options BenchmarkOptions) (BenchmarkResult, error) {
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	value := strings.Repeat("x", options.ValueSize)
+
+	conns := make([]*Conn, concurrency)
+	for i := range conns {
+		conn, err := c.Connect(ctx)
+		if err != nil {
+			return BenchmarkResult{}, err
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		latencies = make([]time.Duration, 0, options.Operations)
+		firstErr  error
+	)
+
+	start := time.Now()
+	for worker, conn := range conns {
+		operations := options.Operations / concurrency
+		if worker < options.Operations%concurrency {
+			operations++
+		}
+
+		wg.Add(1)
+		go func(worker int, conn *Conn, operations int) {
+			defer wg.Done()
+
+			measured := make([]time.Duration, 0, operations)
+			key := "smoke-bench:" + strconv.Itoa(worker)
+			var err error
+			for i := 0; i < operations && err == nil; i++ {
+				began := time.Now()
+				if i%2 == 0 {
+					_, err = conn.String(ctx, "SET", key, value)
+				} else {
+					_, err = conn.String(ctx, "GET", key)
+				}
+				measured = append(measured, time.Since(began))
+			}
+			if err == nil {
+				_, err = conn.Do(ctx, "DEL", key)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			latencies = append(latencies, measured...)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(worker, conn, operations)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if firstErr != nil {
+		return BenchmarkResult{}, firstErr
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return BenchmarkResult{
+		Operations:   len(latencies),
+		Elapsed:      elapsed,
+		P50:          percentile(latencies, 0.50),
+		P95:          percentile(latencies, 0.95),
+		P99:          percentile(latencies, 0.99),
+		OpsPerSecond: float64(len(latencies)) / elapsed.Seconds(),
+	}, nil
+}
+
+func (t BenchmarkThresholds) breaches(result BenchmarkResult) []string {
+	var breaches []string
+	for _, latency := range []struct {
+		name      string
+		actual    time.Duration
+		threshold time.Duration
+	}{
+		{"p50", result.P50, t.P50},
+		{"p95", result.P95, t.P95},
+		{"p99", result.P99, t.P99},
+	} {
+		if latency.threshold > 0 && latency.actual > latency.threshold {
+			breaches = append(breaches, fmt.Sprintf("%s latency %s above %s", latency.name, latency.actual, latency.threshold))
+		}
+	}
+
+	if t.MinOpsPerSecond > 0 && result.OpsPerSecond < t.MinOpsPerSecond {
+		breaches = append(breaches, fmt.Sprintf("%.0f ops/sec below %.0f ops/sec", result.OpsPerSecond, t.MinOpsPerSecond))
+	}
+	return breaches
+}
+
+// percentile uses the nearest-rank method on sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,73 @@
+package redis_test
+
+import (
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Benchmark", func() {
+	var (
+		fake     *fakeRedis
+		client   *redis.Client
+		failures []string
+		result   redis.BenchmarkResult
+		options  = redis.BenchmarkOptions{Operations: 101, Concurrency: 4, ValueSize: 16}
+	)
+
+	BeforeEach(func() {
+		fake = newFakeRedis("")
+		credentials := smokeTestCF.Credentials{Host: fake.host(), Port: fake.port()}
+		failures = nil
+		result = redis.BenchmarkResult{}
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	})
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("runs every operation and records the latency distribution", func() {
+		client.Benchmark(options, redis.BenchmarkThresholds{P99: time.Minute}, &result)()
+
+		Expect(failures).To(BeEmpty())
+		Expect(result.Operations).To(Equal(101))
+		Expect(result.P50).To(BeNumerically(">", 0))
+		Expect(result.P50).To(BeNumerically("<=", result.P95))
+		Expect(result.P95).To(BeNumerically("<=", result.P99))
+		Expect(result.OpsPerSecond).To(BeNumerically(">", 0))
+		Expect(result.Metrics()).To(HaveKeyWithValue("ops_per_second", result.OpsPerSecond))
+		Expect(result.Metrics()).To(HaveKey("p99_ms"))
+	})
+
+	It("cleans up its keys", func() {
+		client.Benchmark(options, redis.BenchmarkThresholds{}, &result)()
+
+		client.AssertAbsent("smoke-bench:0")()
+		Expect(failures).To(BeEmpty())
+	})
+
+	It("fails listing the breached thresholds", func() {
+		fake.handle("GET", func([]string) string {
+			time.Sleep(2 * time.Millisecond)
+			return "$1\r\nx\r\n"
+		})
+
+		client.Benchmark(options, redis.BenchmarkThresholds{
+			P95:             time.Millisecond,
+			MinOpsPerSecond: 1e9,
+		}, &result)()
+
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0]).To(haveFailure(failreason.BenchmarkThresholdBreached, HavePrefix("Redis benchmark breached its thresholds: p95 latency ")))
+		Expect(failures[0]).To(ContainSubstring("above 1ms"))
+		Expect(failures[0]).To(ContainSubstring("ops/sec below 1000000000 ops/sec"))
+	})
+})
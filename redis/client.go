@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// Client talks RESP directly to a service instance using the credentials from
+// its service key, bypassing the example app
+type Client struct {
+	credentials  *smokeTestCF.Credentials
+	tls          bool
+	timeout      time.Duration
+	retryBackoff retry.Backoff
+	observer     retry.Observer
+	failHandler  func(message string, callerSkip ...int)
+}
+
+// NewClient creates a Client for the service key at credentials. The
+// credentials are only read when a step runs, so they may be filled in by an
+// earlier step such as CF.GetServiceKey.
+func NewClient(credentials *smokeTestCF.Credentials, timeout, retryInterval time.Duration) *Client {
+	return &Client{
+		credentials:  credentials,
+		timeout:      timeout,
+		retryBackoff: retry.None(retryInterval),
+		failHandler:  ginkgo.Fail,
+	}
+}
+
+// WithFailHandler replaces ginkgo.Fail as the handler for failed steps
+func (c *Client) WithFailHandler(handler func(message string, callerSkip ...int)) *Client {
+	c.failHandler = handler
+	return c
+}
+
+// WithObserver notifies o of every attempt the Client's steps make
+func (c *Client) WithObserver(o retry.Observer) *Client {
+	c.observer = o
+	return c
+}
+
+// TLS returns a copy of the Client that connects to the TLS port
+func (c *Client) TLS() *Client {
+	tlsClient := *c
+	tlsClient.tls = true
+	return &tlsClient
+}
+
+// Address is the host:port the Client connects to
+func (c *Client) Address() string {
+	port := c.credentials.Port
+	if c.tls {
+		port = c.credentials.TLS_Port
+	}
+	return net.JoinHostPort(c.credentials.Host, strconv.Itoa(port))
+}
+
+// TLSConfig verifies the server against the key's CA certificate when it has
+// one, and otherwise skips verification like the example app does; see
+// TLSWarning
+func (c *Client) TLSConfig() (*tls.Config, error) {
+	if c.credentials.TLS_CA_Cert == "" {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(c.credentials.TLS_CA_Cert)) {
+		return nil, errors.New("service key tls_ca_cert contains no valid certificates")
+	}
+	return &tls.Config{RootCAs: pool, ServerName: c.credentials.Host}, nil
+}
+
+// Connect dials the instance and authenticates with the key's password, if any
+func (c *Client) Connect(ctx context.Context) (*Conn, error) {
+	var tlsConfig *tls.Config
+	if c.tls {
+		var err error
+		if tlsConfig, err = c.TLSConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := Dial(ctx, c.Address(), tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.credentials.Password != "" {
+		if _, err := conn.Do(ctx, "AUTH", c.credentials.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("AUTH failed: %s", err)
+		}
+	}
+	return conn, nil
+}
+
+// Ping checks that the instance answers PING with PONG
+func (c *Client) Ping() func() {
+	return c.step(failreason.New(failreason.RedisUnreachable, "Redis did not respond to PING"), func(ctx context.Context, conn *Conn) error {
+		fmt.Println("Sending PING to", c.Address())
+		pong, err := conn.String(ctx, "PING")
+		if err == nil && pong != "PONG" {
+			err = fmt.Errorf("unexpected reply %q", pong)
+		}
+		return err
+	})
+}
+
+// Write sets key to value
+func (c *Client) Write(key, value string) func() {
+	return c.step(failreason.New(failreason.RedisWriteFailed, "Failed to SET key").With("key", key), func(ctx context.Context, conn *Conn) error {
+		fmt.Printf("Setting %s on %s\n", key, c.Address())
+		_, err := conn.String(ctx, "SET", key, value)
+		return err
+	})
+}
+
+// ReadAssert checks that the value for the given key matches expected
+func (c *Client) ReadAssert(key, expectedValue string) func() {
+	return c.step(failreason.New(failreason.RedisReadFailed, "Failed to GET expected value %q", expectedValue).With("key", key), func(ctx context.Context, conn *Conn) error {
+		fmt.Printf("Getting %s from %s\n", key, c.Address())
+		value, err := conn.String(ctx, "GET", key)
+		if err == nil && value != expectedValue {
+			err = fmt.Errorf("got %q", value)
+		}
+		return err
+	})
+}
+
+// AssertAbsent checks that key does not exist on the instance
+func (c *Client) AssertAbsent(key string) func() {
+	return c.step(failreason.New(failreason.IsolationBreached, "Expected key to be absent").With("key", key), func(ctx context.Context, conn *Conn) error {
+		fmt.Printf("Checking %s is absent from %s\n", key, c.Address())
+		exists, err := conn.Int(ctx, "EXISTS", key)
+		if err == nil && exists != 0 {
+			err = fmt.Errorf("key %s is present", key)
+		}
+		return err
+	})
+}
+
+// Delete removes key and checks that it is gone
+func (c *Client) Delete(key string) func() {
+	return c.step(failreason.New(failreason.RedisDeleteFailed, "Failed to DEL key").With("key", key), func(ctx context.Context, conn *Conn) error {
+		fmt.Printf("Deleting %s on %s\n", key, c.Address())
+		if _, err := conn.Int(ctx, "DEL", key); err != nil {
+			return err
+		}
+		if _, err := conn.String(ctx, "GET", key); err != ErrNil {
+			return fmt.Errorf("key still present after DEL: %v", err)
+		}
+		return nil
+	})
+}
+
+// step runs fn as a step, failing with failure, once named with the Client's
+// address, if it never succeeds
+func (c *Client) step(failure failreason.Failure, fn func(context.Context, *Conn) error) func() {
+	return func() {
+		if err := c.do(fn); err != nil {
+			c.failHandler(c.at(failure).Because(err))
+		}
+	}
+}
+
+// at names the Client's address first among the failure's resources. The
+// address is only known once the service key has been read, so it must not be
+// looked up before the step runs.
+func (c *Client) at(failure failreason.Failure) failreason.Failure {
+	failure.Resources = append([]failreason.Resource{{Kind: "address", Name: c.Address()}}, failure.Resources...)
+	return failure
+}
+
+// do runs fn on a fresh connection, retrying on any error
+func (c *Client) do(fn func(context.Context, *Conn) error) error {
+	return c.retry(func(ctx context.Context) error {
+		conn, err := c.Connect(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return fn(ctx, conn)
+	})
+}
+
+func (c *Client) retry(op func(context.Context) error) error {
+	policy := retry.DefaultPolicy()
+	policy.SessionTimeout = c.timeout
+	policy.Backoff = c.retryBackoff
+	if c.observer != nil {
+		policy.Observers = []retry.Observer{c.observer}
+	}
+
+	_, err := policy.Do(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return nil, op(ctx)
+	}, retry.NoError)
+	return err
+}
@@ -0,0 +1,164 @@
+package redis_test
+
+import (
+	"context"
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		fake        *fakeRedis
+		credentials smokeTestCF.Credentials
+		client      *redis.Client
+		failures    []string
+	)
+
+	BeforeEach(func() {
+		fake = newFakeRedis("secret")
+		credentials = smokeTestCF.Credentials{
+			Host:     fake.host(),
+			Port:     fake.port(),
+			Password: "secret",
+		}
+		failures = nil
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	})
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("authenticates with the service key password", func() {
+		client.Ping()()
+
+		Expect(fake.received()).To(Equal([][]string{
+			{"AUTH", "secret"},
+			{"PING"},
+		}))
+	})
+
+	It("writes, reads and deletes keys", func() {
+		client.Write("mykey", "myvalue")()
+		client.ReadAssert("mykey", "myvalue")()
+		client.Delete("mykey")()
+
+		conn, err := client.Connect(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		_, err = conn.String(context.Background(), "GET", "mykey")
+		Expect(err).To(Equal(redis.ErrNil))
+	})
+
+	It("asserts keys are absent", func() {
+		client.AssertAbsent("mykey")()
+		Expect(failures).To(BeEmpty())
+
+		client.Write("mykey", "myvalue")()
+		client.AssertAbsent("mykey")()
+
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0]).To(haveFailure(failreason.IsolationBreached, "Expected key to be absent"))
+		Expect(parseFailure(failures[0]).Resources).To(ContainElement(failreason.Resource{Kind: "key", Name: "mykey"}))
+		Expect(failures[0]).To(ContainSubstring("key mykey is present"))
+	})
+
+	It("reads credentials when the step runs", func() {
+		ping := client.Ping()
+		credentials.Password = "wrong"
+		ping()
+
+		Expect(failures).To(ConsistOf(
+			And(
+				haveFailure(failreason.RedisUnreachable, "Redis did not respond to PING"),
+				ContainSubstring("WRONGPASS"),
+			),
+		))
+	})
+
+	It("names the address the step connected to once the key has been read", func() {
+		address := client.Address()
+		credentials = smokeTestCF.Credentials{}
+		read := client.ReadAssert("mykey", "myvalue")
+		dataType, err := client.DataType("hashes", "mykey")
+		Expect(err).NotTo(HaveOccurred())
+
+		credentials = smokeTestCF.Credentials{Host: fake.host(), Port: fake.port(), Password: "secret"}
+		client.Write("mykey", "other")()
+		read()
+		fake.close()
+		dataType()
+
+		Expect(failures).To(HaveLen(2))
+		for _, failure := range failures {
+			Expect(parseFailure(failure).Resources).To(HaveLen(2))
+			Expect(parseFailure(failure).Resources[0]).To(Equal(failreason.Resource{Kind: "address", Name: address}))
+			Expect(parseFailure(failure).Resources[1]).To(Equal(failreason.Resource{Kind: "key", Name: "mykey"}))
+		}
+	})
+
+	It("fails with the FailReason when the value does not match", func() {
+		client.Write("mykey", "other")()
+
+		client.ReadAssert("mykey", "myvalue")()
+
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0]).To(haveFailure(failreason.RedisReadFailed, `Failed to GET expected value "myvalue"`))
+		Expect(failures[0]).To(ContainSubstring(`got "other"`))
+	})
+
+	Describe("Conn", func() {
+		var conn *redis.Conn
+
+		BeforeEach(func() {
+			var err error
+			conn, err = client.Connect(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("decodes arrays, integers and null elements", func() {
+			fake.handle("MGET", func([]string) string {
+				return "*3\r\n$1\r\na\r\n:2\r\n$-1\r\n"
+			})
+
+			reply, err := conn.Do(context.Background(), "MGET", "a", "b", "c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply).To(Equal([]interface{}{"a", int64(2), nil}))
+
+			values, err := conn.Strings(context.Background(), "MGET", "a", "b", "c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).To(Equal([]string{"a", "2", ""}))
+		})
+
+		It("returns error replies as a ReplyError", func() {
+			_, err := conn.Do(context.Background(), "NOPE")
+			Expect(err).To(Equal(redis.ReplyError("ERR unknown command 'NOPE'")))
+		})
+
+		It("gives up when the context is done", func() {
+			fake.handle("BLPOP", func([]string) string {
+				time.Sleep(time.Second)
+				return "*-1\r\n"
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := conn.Do(ctx, "BLPOP", "queue", "0")
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+	})
+})
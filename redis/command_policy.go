@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// rejections are the error replies Redis gives for commands that have been
+// renamed away, blocked by an ACL or switched off by configuration. Any other
+// reply, including a syntax error, means the command is available.
+var rejections = []string{
+	"ERR unknown command",
+	"NOPERM",
+	"not allowed",
+}
+
+// IsRejected reports whether err is Redis refusing to run a command at all
+func IsRejected(err error) bool {
+	replyErr, ok := err.(ReplyError)
+	if !ok {
+		return false
+	}
+	for _, rejection := range rejections {
+		if strings.Contains(string(replyErr), rejection) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertCommandsDisabled attempts each command, given with any arguments as a
+// single string such as "CONFIG GET maxmemory", and checks that Redis rejects
+// it
+func (c *Client) AssertCommandsDisabled(commands ...string) func() {
+	return c.assertCommands(commands, true)
+}
+
+// AssertCommandsAllowed attempts each command and checks that Redis does not
+// reject it
+func (c *Client) AssertCommandsAllowed(commands ...string) func() {
+	return c.assertCommands(commands, false)
+}
+
+func (c *Client) assertCommands(commands []string, disabled bool) func() {
+	return func() {
+		var unexpected []string
+		for _, command := range commands {
+			rejected, reply, err := c.attempt(strings.Fields(command))
+			if err != nil {
+				c.failHandler(failreason.New(failreason.RedisUnreachable, "Failed to attempt command %s", command).With("address", c.Address()).Because(err))
+				return
+			}
+
+			fmt.Printf("Attempted %s on %s: %s\n", command, c.Address(), reply)
+			if rejected != disabled {
+				unexpected = append(unexpected, command)
+			}
+		}
+
+		if len(unexpected) == 0 {
+			return
+		}
+		if disabled {
+			c.failHandler(failreason.New(failreason.CommandPolicyViolated, "Disabled commands were unexpectedly permitted: %s", strings.Join(unexpected, ", ")).With("address", c.Address()).String())
+		} else {
+			c.failHandler(failreason.New(failreason.CommandPolicyViolated, "Allowed commands were unexpectedly rejected: %s", strings.Join(unexpected, ", ")).With("address", c.Address()).String())
+		}
+	}
+}
+
+// attempt runs command on its own connection, since commands such as MONITOR
+// leave the connection unusable if they are permitted
+func (c *Client) attempt(command []string) (rejected bool, reply string, err error) {
+	err = c.do(func(ctx context.Context, conn *Conn) error {
+		result, err := conn.Do(ctx, command...)
+		if replyErr, ok := err.(ReplyError); ok {
+			rejected, reply = IsRejected(replyErr), replyErr.Error()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rejected, reply = false, fmt.Sprint(result)
+		return nil
+	})
+	return rejected, reply, err
+}
@@ -0,0 +1,63 @@
+package redis_test
+
+import (
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Command policy", func() {
+	var (
+		fake     *fakeRedis
+		client   *redis.Client
+		failures []string
+	)
+
+	BeforeEach(func() {
+		fake = newFakeRedis("")
+		fake.handle("CONFIG", func([]string) string { return "-ERR wrong number of arguments for 'config' command\r\n" })
+		fake.handle("DEBUG", func([]string) string { return "-ERR DEBUG command not allowed.\r\n" })
+		fake.handle("SAVE", func([]string) string { return "-NOPERM this user has no permissions to run the 'save' command\r\n" })
+
+		credentials := smokeTestCF.Credentials{Host: fake.host(), Port: fake.port()}
+		failures = nil
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	})
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("passes when every disabled command is rejected", func() {
+		client.AssertCommandsDisabled("FLUSHALL", "DEBUG SLEEP 0", "SAVE")()
+
+		Expect(failures).To(BeEmpty())
+		Expect(fake.received()).To(ContainElement([]string{"DEBUG", "SLEEP", "0"}))
+	})
+
+	It("names exactly the disabled commands that were permitted", func() {
+		client.AssertCommandsDisabled("FLUSHALL", "CONFIG", "PING", "SAVE")()
+
+		Expect(failures).To(ConsistOf(haveFailure(failreason.CommandPolicyViolated, "Disabled commands were unexpectedly permitted: CONFIG, PING")))
+	})
+
+	It("names the allowed commands that were rejected", func() {
+		client.AssertCommandsAllowed("PING", "CONFIG", "MONITOR")()
+
+		Expect(failures).To(ConsistOf(haveFailure(failreason.CommandPolicyViolated, "Allowed commands were unexpectedly rejected: MONITOR")))
+	})
+
+	It("only treats refusals as rejections", func() {
+		Expect(redis.IsRejected(redis.ReplyError("ERR unknown command 'FLUSHALL'"))).To(BeTrue())
+		Expect(redis.IsRejected(redis.ReplyError("NOPERM no permissions"))).To(BeTrue())
+		Expect(redis.IsRejected(redis.ReplyError("ERR syntax error"))).To(BeFalse())
+		Expect(redis.IsRejected(redis.ErrNil)).To(BeFalse())
+	})
+})
@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+type dataTypeCheck func(ctx context.Context, conn *Conn, key string) error
+
+var dataTypeChecks = map[string]dataTypeCheck{
+	"lists":       checkLists,
+	"hashes":      checkHashes,
+	"sets":        checkSets,
+	"sorted_sets": checkSortedSets,
+	"streams":     checkStreams,
+	"expiry":      checkExpiry,
+	"scripting":   checkScripting,
+}
+
+// DataTypes lists the names accepted by Client.DataType
+func DataTypes() []string {
+	names := make([]string, 0, len(dataTypeChecks))
+	for name := range dataTypeChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DataType returns a step that exercises the named data type on key, deleting
+// it before and after
+func (c *Client) DataType(name, key string) (func(), error) {
+	check, ok := dataTypeChecks[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown data type %q, expected one of %s", name, strings.Join(DataTypes(), ", "))
+	}
+
+	return c.step(failreason.New(failreason.DataTypeFailed, "Redis %s check failed", name).With("key", key), func(ctx context.Context, conn *Conn) error {
+		fmt.Printf("Checking %s using %s on %s\n", name, key, c.Address())
+		if _, err := conn.Do(ctx, "DEL", key); err != nil {
+			return err
+		}
+		if err := check(ctx, conn, key); err != nil {
+			return err
+		}
+		_, err := conn.Do(ctx, "DEL", key)
+		return err
+	}), nil
+}
+
+func checkLists(ctx context.Context, conn *Conn, key string) error {
+	if err := expectInt(conn.Int(ctx, "RPUSH", key, "a", "b", "c"))(3, "RPUSH"); err != nil {
+		return err
+	}
+	if err := expectString(conn.String(ctx, "LPOP", key))("a", "LPOP"); err != nil {
+		return err
+	}
+	if err := expectString(conn.String(ctx, "RPOP", key))("c", "RPOP"); err != nil {
+		return err
+	}
+	return expectStrings(conn.Strings(ctx, "LRANGE", key, "0", "-1"))([]string{"b"}, "LRANGE")
+}
+
+func checkHashes(ctx context.Context, conn *Conn, key string) error {
+	if err := expectInt(conn.Int(ctx, "HSET", key, "f1", "v1", "f2", "v2"))(2, "HSET"); err != nil {
+		return err
+	}
+
+	pairs, err := conn.Strings(ctx, "HGETALL", key)
+	if err != nil {
+		return err
+	}
+	hash := map[string]string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		hash[pairs[i]] = pairs[i+1]
+	}
+	if expected := map[string]string{"f1": "v1", "f2": "v2"}; !reflect.DeepEqual(hash, expected) {
+		return fmt.Errorf("HGETALL returned %v, expected %v", hash, expected)
+	}
+	return nil
+}
+
+func checkSets(ctx context.Context, conn *Conn, key string) error {
+	if err := expectInt(conn.Int(ctx, "SADD", key, "a", "b", "c", "a"))(3, "SADD"); err != nil {
+		return err
+	}
+	if err := expectInt(conn.Int(ctx, "SISMEMBER", key, "b"))(1, "SISMEMBER"); err != nil {
+		return err
+	}
+
+	members, err := conn.Strings(ctx, "SMEMBERS", key)
+	sort.Strings(members)
+	return expectStrings(members, err)([]string{"a", "b", "c"}, "SMEMBERS")
+}
+
+func checkSortedSets(ctx context.Context, conn *Conn, key string) error {
+	if err := expectInt(conn.Int(ctx, "ZADD", key, "3", "c", "1", "a", "2", "b"))(3, "ZADD"); err != nil {
+		return err
+	}
+	return expectStrings(conn.Strings(ctx, "ZRANGE", key, "0", "-1"))([]string{"a", "b", "c"}, "ZRANGE")
+}
+
+func checkStreams(ctx context.Context, conn *Conn, key string) error {
+	id, err := conn.String(ctx, "XADD", key, "*", "field", "value")
+	if err != nil {
+		return err
+	}
+
+	reply, err := conn.Do(ctx, "XREAD", "COUNT", "10", "STREAMS", key, "0")
+	if err != nil {
+		return err
+	}
+
+	// [[key, [[id, [field, value]]]]]
+	expected := []interface{}{
+		[]interface{}{key, []interface{}{
+			[]interface{}{id, []interface{}{"field", "value"}},
+		}},
+	}
+	if !reflect.DeepEqual(reply, expected) {
+		return fmt.Errorf("XREAD returned %v, expected %v", reply, expected)
+	}
+	return nil
+}
+
+func checkExpiry(ctx context.Context, conn *Conn, key string) error {
+	if _, err := conn.String(ctx, "SET", key, "value"); err != nil {
+		return err
+	}
+	if err := expectInt(conn.Int(ctx, "EXPIRE", key, "100"))(1, "EXPIRE"); err != nil {
+		return err
+	}
+
+	ttl, err := conn.Int(ctx, "TTL", key)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 || ttl > 100 {
+		return fmt.Errorf("TTL returned %d, expected a value in (0, 100]", ttl)
+	}
+	return nil
+}
+
+func checkScripting(ctx context.Context, conn *Conn, key string) error {
+	set := "return redis.call('SET', KEYS[1], ARGV[1])"
+	if err := expectString(conn.String(ctx, "EVAL", set, "1", key, "value"))("OK", "EVAL SET"); err != nil {
+		return err
+	}
+
+	get := "return redis.call('GET', KEYS[1])"
+	return expectString(conn.String(ctx, "EVAL", get, "1", key))("value", "EVAL GET")
+}
+
+func expectInt(actual int64, err error) func(expected int64, command string) error {
+	return func(expected int64, command string) error {
+		if err != nil {
+			return fmt.Errorf("%s: %s", command, err)
+		}
+		if actual != expected {
+			return fmt.Errorf("%s returned %d, expected %d", command, actual, expected)
+		}
+		return nil
+	}
+}
+
+func expectString(actual string, err error) func(expected, command string) error {
+	return func(expected, command string) error {
+		if err != nil {
+			return fmt.Errorf("%s: %s", command, err)
+		}
+		if actual != expected {
+			return fmt.Errorf("%s returned %q, expected %q", command, actual, expected)
+		}
+		return nil
+	}
+}
+
+func expectStrings(actual []string, err error) func(expected []string, command string) error {
+	return func(expected []string, command string) error {
+		if err != nil {
+			return fmt.Errorf("%s: %s", command, err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			return fmt.Errorf("%s returned %q, expected %q", command, actual, expected)
+		}
+		return nil
+	}
+}
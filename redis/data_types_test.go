@@ -0,0 +1,68 @@
+package redis_test
+
+import (
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DataType", func() {
+	var (
+		fake        *fakeRedis
+		credentials smokeTestCF.Credentials
+		client      *redis.Client
+		failures    []string
+	)
+
+	BeforeEach(func() {
+		fake = newFakeRedis("")
+		credentials = smokeTestCF.Credentials{Host: fake.host(), Port: fake.port()}
+		failures = nil
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	})
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("rejects unknown data types", func() {
+		_, err := client.DataType("graphs", "key")
+		Expect(err).To(MatchError(ContainSubstring(`unknown data type "graphs"`)))
+		Expect(err).To(MatchError(ContainSubstring("sorted_sets")))
+	})
+
+	It("runs the check between deleting the key", func() {
+		fake.handle("ZADD", func([]string) string { return ":3\r\n" })
+		fake.handle("ZRANGE", func([]string) string { return "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n" })
+
+		check, err := client.DataType("sorted_sets", "smoke-zset")
+		Expect(err).NotTo(HaveOccurred())
+		check()
+
+		Expect(failures).To(BeEmpty())
+		Expect(fake.received()).To(Equal([][]string{
+			{"DEL", "smoke-zset"},
+			{"ZADD", "smoke-zset", "3", "c", "1", "a", "2", "b"},
+			{"ZRANGE", "smoke-zset", "0", "-1"},
+			{"DEL", "smoke-zset"},
+		}))
+	})
+
+	It("fails with the command that misbehaved", func() {
+		check, err := client.DataType("scripting", "smoke-script")
+		Expect(err).NotTo(HaveOccurred())
+		check()
+
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0]).To(haveFailure(failreason.DataTypeFailed, "Redis scripting check failed"))
+		Expect(parseFailure(failures[0]).Resources).To(ContainElement(failreason.Resource{Kind: "key", Name: "smoke-script"}))
+		Expect(failures[0]).To(ContainSubstring("EVAL SET: ERR unknown command 'EVAL'"))
+	})
+})
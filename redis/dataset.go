@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// WriteDataset writes count keys named prefix:0 to prefix:<count-1>, each
+// holding a value derived from its name
+func (c *Client) WriteDataset(prefix string, count int) func() {
+	return c.step(failreason.New(failreason.RedisWriteFailed, "Failed to write %d keys", count).With("key_prefix", prefix), func(ctx context.Context, conn *Conn) error {
+		fmt.Printf("Writing %d keys under %s to %s\n", count, prefix, c.Address())
+		for i := 0; i < count; i++ {
+			key := datasetKey(prefix, i)
+			if _, err := conn.String(ctx, "SET", key, datasetValue(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AssertDataset reads back a dataset written by WriteDataset and fails if the
+// fraction of keys recovered intact is below minRatio. The ratio is stored in
+// recovered, when it is non-nil, so that it can be reported either way.
+func (c *Client) AssertDataset(prefix string, count int, minRatio float64, recovered *float64) func() {
+	return func() {
+		var intact int
+		err := c.do(func(ctx context.Context, conn *Conn) error {
+			intact = 0
+			for i := 0; i < count; i++ {
+				key := datasetKey(prefix, i)
+				value, err := conn.String(ctx, "GET", key)
+				if err == ErrNil {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if value == datasetValue(key) {
+					intact++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.failHandler(failreason.New(failreason.RedisReadFailed, "Failed to read keys").With("address", c.Address()).With("key_prefix", prefix).Because(err))
+			return
+		}
+
+		ratio := 1.0
+		if count > 0 {
+			ratio = float64(intact) / float64(count)
+		}
+		if recovered != nil {
+			*recovered = ratio
+		}
+
+		fmt.Printf("Recovered %d/%d keys under %s (%.1f%%)\n", intact, count, prefix, ratio*100)
+		if ratio < minRatio {
+			c.failHandler(failreason.New(
+				failreason.DataLost,
+				"Only recovered %d/%d keys (%.1f%%), expected at least %.1f%%",
+				intact, count, ratio*100, minRatio*100,
+			).With("address", c.Address()).With("key_prefix", prefix).String())
+		}
+	}
+}
+
+func datasetKey(prefix string, i int) string {
+	return prefix + ":" + strconv.Itoa(i)
+}
+
+func datasetValue(key string) string {
+	return "value-of-" + key
+}
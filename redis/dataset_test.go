@@ -0,0 +1,61 @@
+package redis_test
+
+import (
+	"context"
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dataset", func() {
+	var (
+		fake      *fakeRedis
+		client    *redis.Client
+		failures  []string
+		recovered float64
+	)
+
+	BeforeEach(func() {
+		fake = newFakeRedis("")
+		credentials := smokeTestCF.Credentials{Host: fake.host(), Port: fake.port()}
+		failures = nil
+		recovered = -1
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+
+		client.WriteDataset("persistence", 10)()
+	})
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("recovers every key that was written", func() {
+		client.AssertDataset("persistence", 10, 1, &recovered)()
+
+		Expect(failures).To(BeEmpty())
+		Expect(recovered).To(Equal(1.0))
+	})
+
+	It("reports the ratio of keys recovered intact", func() {
+		conn, err := client.Connect(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		_, err = conn.Do(context.Background(), "DEL", "persistence:0", "persistence:1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.Do(context.Background(), "SET", "persistence:2", "corrupt")
+		Expect(err).NotTo(HaveOccurred())
+
+		client.AssertDataset("persistence", 10, 0.9, &recovered)()
+
+		Expect(recovered).To(BeNumerically("~", 0.7, 0.001))
+		Expect(failures).To(ConsistOf(haveFailure(failreason.DataLost, "Only recovered 7/10 keys (70.0%), expected at least 90.0%")))
+	})
+})
@@ -0,0 +1,174 @@
+package redis_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeRedis is a tiny in-memory RESP server. Replies for commands can be
+// overridden through handlers.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	lock     sync.Mutex
+	data     map[string]string
+	commands [][]string
+	handlers map[string]func(args []string) string
+}
+
+func newFakeRedis(password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	fake := &fakeRedis{
+		listener: listener,
+		password: password,
+		data:     map[string]string{},
+		handlers: map[string]func(args []string) string{},
+	}
+	go fake.serve()
+	return fake
+}
+
+func (f *fakeRedis) host() string {
+	return f.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+func (f *fakeRedis) port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeRedis) close() {
+	f.listener.Close()
+}
+
+func (f *fakeRedis) handle(command string, handler func(args []string) string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.handlers[strings.ToUpper(command)] = handler
+}
+
+func (f *fakeRedis) received() [][]string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([][]string{}, f.commands...)
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.serveConn(conn)
+	}
+}
+
+func (f *fakeRedis) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.lock.Lock()
+		f.commands = append(f.commands, args)
+		handler := f.handlers[strings.ToUpper(args[0])]
+		f.lock.Unlock()
+
+		var reply string
+		switch command := strings.ToUpper(args[0]); {
+		case handler != nil:
+			reply = handler(args)
+		case command == "AUTH":
+			if len(args) == 2 && args[1] == f.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = f.reply(command, args[1:])
+		}
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) reply(command string, args []string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch command {
+	case "PING":
+		return "+PONG\r\n"
+	case "SET":
+		f.data[args[0]] = args[1]
+		return "+OK\r\n"
+	case "GET":
+		value, ok := f.data[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "EXISTS":
+		exists := 0
+		for _, key := range args {
+			if _, ok := f.data[key]; ok {
+				exists++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", exists)
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", command)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
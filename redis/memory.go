@@ -0,0 +1,253 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// Info runs INFO for section and parses the reply into its fields
+func (c *Conn) Info(ctx context.Context, section string) (map[string]string, error) {
+	reply, err := c.String(ctx, "INFO", section)
+	if err != nil {
+		return nil, err
+	}
+	return ParseInfo(reply), nil
+}
+
+// ParseInfo parses the "field:value" lines of an INFO reply, skipping
+// section headers
+func ParseInfo(reply string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
+// ParseMemory parses a memory size the way redis.conf does: a plain number of
+// bytes, or one with a k, kb, m, mb, g or gb suffix where k is 1000 and kb is
+// 1024
+func ParseMemory(size string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	number := strings.ToLower(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(number, unit.suffix), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size %q", size)
+	}
+	return n * multiplier, nil
+}
+
+// AssertMemoryConfig checks the instance's maxmemory in bytes, its
+// maxmemory-policy and that its Redis version starts with version. Zero values
+// are not checked.
+func (c *Client) AssertMemoryConfig(maxMemory int64, policy, version string) func() {
+	return func() {
+		var memory, server map[string]string
+		err := c.do(func(ctx context.Context, conn *Conn) error {
+			var err error
+			if memory, err = conn.Info(ctx, "memory"); err != nil {
+				return err
+			}
+			server, err = conn.Info(ctx, "server")
+			return err
+		})
+		if err != nil {
+			c.failHandler(failreason.New(failreason.RedisUnreachable, "Failed to read INFO").With("address", c.Address()).Because(err))
+			return
+		}
+
+		fmt.Printf("%s: maxmemory %s, maxmemory_policy %s, redis_version %s\n",
+			c.Address(), memory["maxmemory"], memory["maxmemory_policy"], server["redis_version"])
+
+		var mismatches []string
+		if maxMemory != 0 && memory["maxmemory"] != strconv.FormatInt(maxMemory, 10) {
+			mismatches = append(mismatches, fmt.Sprintf("maxmemory is %s, expected %d", memory["maxmemory"], maxMemory))
+		}
+		if policy != "" && memory["maxmemory_policy"] != policy {
+			mismatches = append(mismatches, fmt.Sprintf("maxmemory-policy is %s, expected %s", memory["maxmemory_policy"], policy))
+		}
+		if version != "" && !versionMatches(server["redis_version"], version) {
+			mismatches = append(mismatches, fmt.Sprintf("Redis version is %s, expected %s", server["redis_version"], version))
+		}
+
+		if len(mismatches) > 0 {
+			c.failHandler(failreason.New(failreason.MemoryConfigMismatch, "Redis memory configuration does not match the plan: %s", strings.Join(mismatches, ", ")).With("address", c.Address()).String())
+		}
+	}
+}
+
+// versionMatches reports whether actual is expected or a release within it,
+// so that "6.2" matches "6.2.7" but not "6.20.1"
+func versionMatches(actual, expected string) bool {
+	return actual == expected || strings.HasPrefix(actual, expected+".")
+}
+
+// AssertEviction fills the instance past its maxmemory and checks that it
+// behaves as its maxmemory-policy declares: noeviction rejects writes with an
+// OOM error, any other policy evicts keys. The fill stops at the first OOM
+// reply or evicted key, and writes no more than the instance's free memory
+// plus half its maxmemory. A retried attempt carries on from the keys already
+// written. Fill keys carry a TTL so that the volatile-* policies can evict
+// them, and are deleted afterwards over a new connection.
+func (c *Client) AssertEviction() func() {
+	return func() {
+		var (
+			policy        string
+			limit         int64
+			written       int64
+			evictedBefore int64
+			evicted       int64
+			oom           string
+			keys          int
+		)
+
+		err := c.do(func(ctx context.Context, conn *Conn) error {
+			memory, err := conn.Info(ctx, "memory")
+			if err != nil {
+				return err
+			}
+			policy = memory["maxmemory_policy"]
+			maxMemory, _ := strconv.ParseInt(memory["maxmemory"], 10, 64)
+			if maxMemory <= 0 {
+				return fmt.Errorf("maxmemory is not set, so Redis will never evict")
+			}
+
+			if limit == 0 {
+				used, _ := strconv.ParseInt(memory["used_memory"], 10, 64)
+				limit = fillLimit(maxMemory, used)
+				if evictedBefore, err = evictedKeys(ctx, conn); err != nil {
+					limit = 0
+					return err
+				}
+			}
+
+			chunk := fillChunkSize(maxMemory)
+			value := strings.Repeat("x", int(chunk))
+			for written < limit {
+				_, err := conn.Do(ctx, "SET", fillKey(keys), value, "EX", "600")
+				if replyErr, ok := err.(ReplyError); ok && strings.HasPrefix(string(replyErr), "OOM") {
+					oom = replyErr.Error()
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				written += chunk
+				keys++
+
+				// checking every write would double the round trips while
+				// the instance still has room, so only check every 64 until
+				// the fill reaches the memory that was free
+				if written >= limit-maxMemory/2 || keys%64 == 0 {
+					total, err := evictedKeys(ctx, conn)
+					if err != nil {
+						return err
+					}
+					if evicted = total - evictedBefore; evicted > 0 {
+						return nil
+					}
+				}
+			}
+			return nil
+		})
+
+		if keys > 0 {
+			if err := c.do(func(ctx context.Context, conn *Conn) error {
+				return deleteFill(ctx, conn, keys)
+			}); err != nil {
+				fmt.Printf("Failed to delete the fill keys from %s, which expire in 10 minutes: %s\n", c.Address(), err)
+			}
+		}
+
+		if err != nil {
+			c.failHandler(failreason.New(failreason.EvictionMisbehaved, "Failed to fill Redis to its maxmemory").With("address", c.Address()).Because(err))
+			return
+		}
+
+		fmt.Printf("Filled %s with policy %s: wrote %d bytes, %d keys evicted, OOM reply %q\n", c.Address(), policy, written, evicted, oom)
+		switch {
+		case oom == "" && evicted == 0:
+			c.failHandler(failreason.New(failreason.EvictionMisbehaved, "Redis with maxmemory-policy %s neither evicted keys nor rejected writes after %d bytes", policy, written).With("address", c.Address()).String())
+		case policy == "noeviction" && evicted > 0:
+			c.failHandler(failreason.New(failreason.EvictionMisbehaved, "Redis with maxmemory-policy noeviction evicted %d keys", evicted).With("address", c.Address()).String())
+		case policy != "noeviction" && oom != "":
+			c.failHandler(failreason.New(failreason.EvictionMisbehaved, "Redis with maxmemory-policy %s rejected writes instead of evicting: %s", policy, oom).With("address", c.Address()).String())
+		}
+	}
+}
+
+// fillLimit is how many bytes a fill may write: the memory free below
+// maxmemory, plus half of maxmemory again since Redis counts its own
+// overheads against maxmemory and evicts before the values alone reach it
+func fillLimit(maxMemory, used int64) int64 {
+	free := maxMemory - used
+	if free < 0 {
+		free = 0
+	}
+	return free + maxMemory/2
+}
+
+func evictedKeys(ctx context.Context, conn *Conn) (int64, error) {
+	stats, err := conn.Info(ctx, "stats")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(stats["evicted_keys"], 10, 64)
+}
+
+// fillChunkSize keeps a fill to a few thousand writes whatever the plan size
+func fillChunkSize(maxMemory int64) int64 {
+	chunk := maxMemory / 512
+	if chunk < 1<<10 {
+		return 1 << 10
+	}
+	if chunk > 1<<20 {
+		return 1 << 20
+	}
+	return chunk
+}
+
+func fillKey(i int) string {
+	return "smoke-fill:" + strconv.Itoa(i)
+}
+
+// deleteFill deletes the fill keys, including the one whose SET may have been
+// interrupted
+func deleteFill(ctx context.Context, conn *Conn, keys int) error {
+	for start := 0; start <= keys; start += 100 {
+		command := []string{"DEL"}
+		for i := start; i < start+100 && i <= keys; i++ {
+			command = append(command, fillKey(i))
+		}
+		if _, err := conn.Do(ctx, command...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
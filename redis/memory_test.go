@@ -0,0 +1,178 @@
+package redis_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory", func() {
+	var (
+		fake     *fakeRedis
+		client   *redis.Client
+		failures []string
+		policy   string
+		evicted  int64
+	)
+
+	bulk := func(s string) string {
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+	}
+
+	BeforeEach(func() {
+		policy = "allkeys-lru"
+		atomic.StoreInt64(&evicted, 0)
+
+		fake = newFakeRedis("")
+		fake.handle("INFO", func(args []string) string {
+			switch args[1] {
+			case "memory":
+				return bulk(fmt.Sprintf("# Memory\r\nused_memory:1024\r\nmaxmemory:1048576\r\nmaxmemory_policy:%s\r\n", policy))
+			case "server":
+				return bulk("# Server\r\nredis_version:6.2.7\r\n")
+			default:
+				return bulk(fmt.Sprintf("# Stats\r\nevicted_keys:%d\r\n", atomic.LoadInt64(&evicted)))
+			}
+		})
+
+		credentials := smokeTestCF.Credentials{Host: fake.host(), Port: fake.port()}
+		failures = nil
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	})
+
+	AfterEach(func() {
+		fake.close()
+	})
+
+	It("parses memory sizes like redis.conf", func() {
+		for size, bytes := range map[string]int64{"1024": 1024, "1k": 1000, "1kb": 1024, "512mb": 512 << 20, "2GB": 2 << 30} {
+			Expect(redis.ParseMemory(size)).To(Equal(bytes), size)
+		}
+
+		_, err := redis.ParseMemory("lots")
+		Expect(err).To(MatchError(`invalid memory size "lots"`))
+	})
+
+	Describe("AssertMemoryConfig", func() {
+		It("passes when the plan expectations match INFO", func() {
+			client.AssertMemoryConfig(1<<20, "allkeys-lru", "6.2")()
+
+			Expect(failures).To(BeEmpty())
+		})
+
+		It("lists every mismatch", func() {
+			client.AssertMemoryConfig(2<<20, "noeviction", "6.20")()
+
+			Expect(failures).To(ConsistOf(
+				haveFailure(failreason.MemoryConfigMismatch, "Redis memory configuration does not match the plan: maxmemory is 1048576, expected 2097152, maxmemory-policy is allkeys-lru, expected noeviction, Redis version is 6.2.7, expected 6.20"),
+			))
+		})
+	})
+
+	Describe("AssertEviction", func() {
+		It("passes when an evicting policy evicts keys", func() {
+			fake.handle("SET", func([]string) string {
+				atomic.AddInt64(&evicted, 1)
+				return "+OK\r\n"
+			})
+
+			client.AssertEviction()()
+
+			Expect(failures).To(BeEmpty())
+		})
+
+		It("passes when noeviction rejects writes", func() {
+			policy = "noeviction"
+			fake.handle("SET", func([]string) string {
+				return "-OOM command not allowed when used memory > 'maxmemory'.\r\n"
+			})
+
+			client.AssertEviction()()
+
+			Expect(failures).To(BeEmpty())
+		})
+
+		It("fails when an evicting policy rejects writes", func() {
+			fake.handle("SET", func([]string) string {
+				return "-OOM command not allowed when used memory > 'maxmemory'.\r\n"
+			})
+
+			client.AssertEviction()()
+
+			Expect(failures).To(ConsistOf(ContainSubstring("maxmemory-policy allkeys-lru rejected writes instead of evicting")))
+		})
+
+		It("fails when nothing happens", func() {
+			fake.handle("SET", func([]string) string { return "+OK\r\n" })
+
+			client.AssertEviction()()
+
+			Expect(failures).To(ConsistOf(
+				haveFailure(failreason.EvictionMisbehaved, "Redis with maxmemory-policy allkeys-lru neither evicted keys nor rejected writes after 1572864 bytes"),
+			))
+		})
+
+		It("stops writing as soon as keys are evicted", func() {
+			var sets int64
+			fake.handle("SET", func([]string) string {
+				if atomic.AddInt64(&sets, 1) == 10 {
+					atomic.AddInt64(&evicted, 1)
+				}
+				return "+OK\r\n"
+			})
+
+			client.AssertEviction()()
+
+			Expect(failures).To(BeEmpty())
+			Expect(atomic.LoadInt64(&sets)).To(BeNumerically("==", 64))
+		})
+
+		It("carries on from the keys already written when an attempt times out, then deletes them all", func() {
+			var sets int64
+			fake.handle("SET", func([]string) string {
+				switch atomic.AddInt64(&sets, 1) {
+				case 5:
+					time.Sleep(300 * time.Millisecond)
+				case 100:
+					atomic.AddInt64(&evicted, 1)
+				}
+				return "+OK\r\n"
+			})
+			credentials := smokeTestCF.Credentials{Host: fake.host(), Port: fake.port()}
+			client = redis.NewClient(&credentials, 100*time.Millisecond, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+				failures = append(failures, message)
+			})
+
+			client.AssertEviction()()
+
+			Expect(failures).To(BeEmpty())
+
+			written := map[string]int{}
+			deleted := map[string]bool{}
+			for _, command := range fake.received() {
+				switch command[0] {
+				case "SET":
+					written[command[1]]++
+				case "DEL":
+					for _, key := range command[1:] {
+						deleted[key] = true
+					}
+				}
+			}
+			Expect(written["smoke-fill:0"]).To(Equal(1))
+			Expect(written["smoke-fill:4"]).To(Equal(2))
+			for key := range written {
+				Expect(deleted).To(HaveKey(key))
+			}
+		})
+	})
+})
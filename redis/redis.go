@@ -3,11 +3,11 @@ package redis
 import (
 	"fmt"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/cloudfoundry-incubator/cf-test-helpers/helpers"
 	"github.com/onsi/gomega/gexec"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
 )
 
@@ -16,6 +16,7 @@ type App struct {
 	uri          string
 	timeout      time.Duration
 	retryBackoff retry.Backoff
+	observer     retry.Observer
 }
 
 // New is the correct way to create a redis.App
@@ -27,13 +28,14 @@ func NewApp(uri string, timeout, retryInterval time.Duration) *App {
 	}
 }
 
-func (app *App) keyURI(key string) string {
-	return fmt.Sprintf("%s/%s", app.uri, key)
+// WithObserver notifies o of every attempt the App's requests make
+func (app *App) WithObserver(o retry.Observer) *App {
+	app.observer = o
+	return app
 }
 
-func (app *App) keyTLSURI(version string, key string) string {
-	tlsVersion := strings.Replace(strings.ToLower(version), "tls", "", -1)
-	return fmt.Sprintf("%s/tls/%s/%s", app.uri, tlsVersion, key)
+func (app *App) keyURI(key string) string {
+	return fmt.Sprintf("%s/%s", app.uri, key)
 }
 
 // IsRunning pings the App
@@ -46,9 +48,9 @@ func (app *App) IsRunning() func() {
 			return helpers.CurlSkipSSL(true, pingURI)
 		}
 
-		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).Until(
+		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).AndObserver(app.observer).Until(
 			retry.MatchesOutput(regexp.MustCompile("key not present")),
-			`{"FailReason": "Test app deployed but did not respond in time"}`,
+			failreason.New(failreason.AppNotResponding, "Test app deployed but did not respond in time").With("url", pingURI).String(),
 		)
 	}
 }
@@ -60,9 +62,9 @@ func (app *App) Write(key, value string) func() {
 			return helpers.CurlSkipSSL(true, "-d", fmt.Sprintf("data=%s", value), "-X", "PUT", app.keyURI(key))
 		}
 
-		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).Until(
+		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).AndObserver(app.observer).Until(
 			retry.MatchesOutput(regexp.MustCompile("success")),
-			fmt.Sprintf(`{"FailReason": "Failed to put to %s"}`, app.keyURI(key)),
+			failreason.New(failreason.AppWriteFailed, "Failed to put to the test app").With("url", app.keyURI(key)).String(),
 		)
 	}
 }
@@ -75,24 +77,24 @@ func (app *App) ReadAssert(key, expectedValue string) func() {
 			return helpers.CurlSkipSSL(true, app.keyURI(key))
 		}
 
-		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).Until(
+		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).AndObserver(app.observer).Until(
 			retry.MatchesOutput(regexp.MustCompile(expectedValue)),
-			fmt.Sprintf(`{"FailReason": "Failed to get %s"}`, app.keyURI(key)),
+			failreason.New(failreason.AppReadFailed, "Failed to get from the test app").With("url", app.keyURI(key)).String(),
 		)
 	}
 }
 
-//ReadTLSAssert checks that the value for the given key matches expected
-func (app *App) ReadTLSAssert(tlsVersion, key, expectedValue string) func() {
+// ReadAbsentAssert checks that the given key is not present
+func (app *App) ReadAbsentAssert(key string) func() {
 	return func() {
 		curlFn := func() *gexec.Session {
-			fmt.Printf("\nGetting from url: %s\n", app.keyTLSURI(tlsVersion, key))
-			return helpers.CurlSkipSSL(false, app.keyTLSURI(tlsVersion, key))
+			fmt.Printf("\nGetting from url: %s\n", app.keyURI(key))
+			return helpers.CurlSkipSSL(true, app.keyURI(key))
 		}
 
-		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).Until(
-			retry.MatchesOutput(regexp.MustCompile(expectedValue)),
-			fmt.Sprintf(`{"FailReason": "Failed to get expected value of '%s' from %s"}`, expectedValue, app.keyTLSURI(tlsVersion, key)),
+		retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).AndObserver(app.observer).Until(
+			retry.MatchesOutput(regexp.MustCompile("key not present")),
+			failreason.New(failreason.IsolationBreached, "Expected key to be absent").With("url", app.keyURI(key)).String(),
 		)
 	}
 }
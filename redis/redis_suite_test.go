@@ -0,0 +1,35 @@
+package redis_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+
+	"testing"
+)
+
+func TestRedis(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Redis Suite")
+}
+
+// haveFailure matches a failure message carrying a Failure with code and a
+// reason matching reason, which is either a string or a matcher
+func haveFailure(code failreason.Code, reason interface{}) types.GomegaMatcher {
+	reasonMatcher, ok := reason.(types.GomegaMatcher)
+	if !ok {
+		reasonMatcher = Equal(reason)
+	}
+
+	return And(
+		WithTransform(func(message string) failreason.Code { return parseFailure(message).Code }, Equal(code)),
+		WithTransform(func(message string) string { return parseFailure(message).Reason }, reasonMatcher),
+	)
+}
+
+func parseFailure(message string) failreason.Failure {
+	failure, _ := failreason.Parse(message)
+	return failure
+}
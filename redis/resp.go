@@ -0,0 +1,241 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrNil is returned by the typed helpers when Redis replies with a null bulk
+// string or array, such as GET on a missing key
+var ErrNil = errors.New("redis: nil reply")
+
+// ReplyError is an error reply sent by Redis, e.g. "ERR unknown command"
+type ReplyError string
+
+func (e ReplyError) Error() string {
+	return string(e)
+}
+
+// Conn is a single RESP connection to a Redis server. It is not safe for
+// concurrent use.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// Dial connects to address, upgrading to TLS when tlsConfig is non-nil. The
+// dial and TLS handshake are bounded by ctx.
+func Dial(ctx context.Context, address string, tlsConfig *tls.Config) (*Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if deadline, ok := ctx.Deadline(); ok {
+			tlsConn.SetDeadline(deadline)
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+
+	return NewConn(conn), nil
+}
+
+// NewConn wraps an established connection
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+// Close closes the underlying connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a command and reads its reply. Replies are decoded as string
+// (simple and bulk strings), int64, []interface{} or nil; error replies are
+// returned as a ReplyError.
+func (c *Conn) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("redis: empty command")
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	if err := c.write(args); err != nil {
+		return nil, c.contextErr(ctx, err)
+	}
+
+	reply, err := c.read()
+	if err != nil {
+		return nil, c.contextErr(ctx, err)
+	}
+	if replyErr, ok := reply.(ReplyError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+// String runs a command that replies with a string
+func (c *Conn) String(ctx context.Context, args ...string) (string, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	switch reply := reply.(type) {
+	case string:
+		return reply, nil
+	case nil:
+		return "", ErrNil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply %v to %s", reply, args[0])
+	}
+}
+
+// Int runs a command that replies with an integer
+func (c *Conn) Int(ctx context.Context, args ...string) (int64, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	if reply, ok := reply.(int64); ok {
+		return reply, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %v to %s", reply, args[0])
+}
+
+// Strings runs a command that replies with an array of strings
+func (c *Conn) Strings(ctx context.Context, args ...string) ([]string, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok {
+		if reply == nil {
+			return nil, ErrNil
+		}
+		return nil, fmt.Errorf("redis: unexpected reply %v to %s", reply, args[0])
+	}
+
+	values := make([]string, len(items))
+	for i, item := range items {
+		switch item := item.(type) {
+		case string:
+			values[i] = item
+		case int64:
+			values[i] = strconv.FormatInt(item, 10)
+		case nil:
+		default:
+			return nil, fmt.Errorf("redis: unexpected array element %v in reply to %s", item, args[0])
+		}
+	}
+	return values, nil
+}
+
+func (c *Conn) contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *Conn) write(args []string) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.w.Flush()
+}
+
+func (c *Conn) read() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return ReplyError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
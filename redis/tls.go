@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// TLSVersions maps the version names used in a service key's tls_versions to
+// their crypto/tls constants
+var TLSVersions = map[string]uint16{
+	"tlsv1":   tls.VersionTLS10,
+	"tlsv1.1": tls.VersionTLS11,
+	"tlsv1.2": tls.VersionTLS12,
+	"tlsv1.3": tls.VersionTLS13,
+}
+
+// TLSProbe is the outcome of a handshake pinned to a single TLS version
+type TLSProbe struct {
+	Version     string
+	Supported   bool
+	CipherSuite string
+	Err         error
+}
+
+func (p TLSProbe) String() string {
+	if !p.Supported {
+		return fmt.Sprintf("%s: not supported (%s)", p.Version, p.Err)
+	}
+	return fmt.Sprintf("%s: negotiated %s", p.Version, p.CipherSuite)
+}
+
+// ProbeTLS performs a handshake with the TLS port pinned to version. When the
+// pinned handshake fails, a second handshake offering every version tells a
+// refused version apart from a broken server: if the server completes it on
+// another version, the pinned version is not supported. Any other failure, such
+// as a reset connection, is an error, as is a successful handshake whose
+// certificate chain does not verify against the key's CA.
+func (c *Client) ProbeTLS(ctx context.Context, version string) (TLSProbe, error) {
+	probe := TLSProbe{Version: version}
+
+	pinned, ok := TLSVersions[version]
+	if !ok {
+		return probe, fmt.Errorf("unknown TLS version %q", version)
+	}
+
+	state, err := c.handshake(ctx, pinned, pinned)
+	if err != nil {
+		negotiated, unpinnedErr := c.handshake(ctx, tls.VersionTLS10, tls.VersionTLS13)
+		if unpinnedErr != nil || negotiated.Version == pinned {
+			return probe, err
+		}
+		probe.Err = fmt.Errorf("%s (server negotiated %s instead)", err, versionName(negotiated.Version))
+		return probe, nil
+	}
+
+	if state.Version != pinned {
+		probe.Err = fmt.Errorf("server negotiated %s", versionName(state.Version))
+		return probe, nil
+	}
+
+	probe.Supported = true
+	probe.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+
+	return probe, c.verifyChain(state.PeerCertificates)
+}
+
+// handshake connects to the TLS port offering versions min to max. The chain
+// is not verified here, so that a version is probed even when the certificate
+// would be refused; ProbeTLS verifies it separately.
+func (c *Client) handshake(ctx context.Context, min, max uint16) (tls.ConnectionState, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.TLS().Address())
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         min,
+		MaxVersion:         max,
+		CipherSuites:       probeCipherSuites(),
+	})
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return tlsConn.ConnectionState(), nil
+}
+
+func versionName(version uint16) string {
+	for name, v := range TLSVersions {
+		if v == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("version 0x%04x", version)
+}
+
+// TLSWarning describes what the Client cannot check over TLS, or is "" when
+// nothing is left unchecked. Without a tls_ca_cert in the service key the
+// server's certificate chain is never verified.
+func (c *Client) TLSWarning() string {
+	if c.credentials.TLS_CA_Cert != "" {
+		return ""
+	}
+	return fmt.Sprintf("service key has no tls_ca_cert, so the certificate chain of %s was not verified", c.TLS().Address())
+}
+
+func (c *Client) verifyChain(chain []*x509.Certificate) error {
+	if c.credentials.TLS_CA_Cert == "" {
+		return nil
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("server at %s presented no certificate", c.TLS().Address())
+	}
+
+	config, err := c.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		DNSName:       config.ServerName,
+		Roots:         config.RootCAs,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return fmt.Errorf("certificate chain does not verify against the service key CA: %s", err)
+	}
+	return nil
+}
+
+// AssertTLSVersions probes every known TLS version and checks that exactly
+// the versions in the key's tls_versions are supported
+func (c *Client) AssertTLSVersions() func() {
+	return func() {
+		expected := map[string]bool{}
+		for _, version := range c.credentials.TLS_Versions {
+			expected[strings.ToLower(version)] = true
+		}
+
+		var mismatches []string
+		for _, version := range sortedTLSVersions() {
+			var probe TLSProbe
+			err := c.retry(func(ctx context.Context) error {
+				var err error
+				probe, err = c.ProbeTLS(ctx, version)
+				return err
+			})
+			if err != nil {
+				c.failHandler(failreason.New(failreason.TLSProbeFailed, "Failed to probe %s on the TLS port", version).With("address", c.TLS().Address()).Because(err))
+				return
+			}
+
+			fmt.Println("TLS probe", c.TLS().Address(), probe)
+			switch {
+			case probe.Supported && !expected[version]:
+				mismatches = append(mismatches, fmt.Sprintf("%s is enabled but not in tls_versions", version))
+			case !probe.Supported && expected[version]:
+				mismatches = append(mismatches, fmt.Sprintf("%s is in tls_versions but not enabled", version))
+			}
+		}
+
+		if len(mismatches) > 0 {
+			c.failHandler(failreason.New(failreason.TLSMismatch, "TLS versions do not match the service key: %s", strings.Join(mismatches, ", ")).
+				With("address", c.TLS().Address()).String())
+		}
+	}
+}
+
+// probeCipherSuites offers every suite crypto/tls implements, so that a version
+// is not reported unsupported just because Go no longer offers its suites by
+// default
+func probeCipherSuites() []uint16 {
+	var ids []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids = append(ids, suite.ID)
+	}
+	return ids
+}
+
+func sortedTLSVersions() []string {
+	versions := make([]string, 0, len(TLSVersions))
+	for version := range TLSVersions {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return TLSVersions[versions[i]] < TLSVersions[versions[j]]
+	})
+	return versions
+}
@@ -0,0 +1,211 @@
+package redis_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS probing", func() {
+	var (
+		listener    net.Listener
+		caPEM       string
+		credentials smokeTestCF.Credentials
+		failures    []string
+		client      *redis.Client
+	)
+
+	listen := func(min, max uint16) {
+		var cert tls.Certificate
+		cert, caPEM = selfSignedCertificate()
+
+		var err error
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   min,
+			MaxVersion:   max,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}()
+			}
+		}()
+
+		credentials = smokeTestCF.Credentials{
+			Host:        "127.0.0.1",
+			TLS_Port:    listener.Addr().(*net.TCPAddr).Port,
+			TLS_CA_Cert: caPEM,
+		}
+	}
+
+	BeforeEach(func() {
+		failures = nil
+		listen(tls.VersionTLS12, tls.VersionTLS13)
+		client = redis.NewClient(&credentials, time.Second, time.Millisecond).WithFailHandler(func(message string, _ ...int) {
+			failures = append(failures, message)
+		})
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	It("passes when exactly the versions in the service key are enabled", func() {
+		credentials.TLS_Versions = []string{"tlsv1.2", "tlsv1.3"}
+
+		client.AssertTLSVersions()()
+
+		Expect(failures).To(BeEmpty())
+	})
+
+	It("fails listing every mismatched version", func() {
+		credentials.TLS_Versions = []string{"tlsv1.1", "tlsv1.2"}
+
+		client.AssertTLSVersions()()
+
+		Expect(failures).To(ConsistOf(
+			haveFailure(failreason.TLSMismatch, "TLS versions do not match the service key: tlsv1.1 is in tls_versions but not enabled, tlsv1.3 is enabled but not in tls_versions"),
+		))
+	})
+
+	It("fails when the certificate does not verify against the service key CA", func() {
+		credentials.TLS_Versions = []string{"tlsv1.2", "tlsv1.3"}
+		_, credentials.TLS_CA_Cert = selfSignedCertificate()
+
+		client.AssertTLSVersions()()
+
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0]).To(haveFailure(failreason.TLSProbeFailed, "Failed to probe tlsv1.2 on the TLS port"))
+		Expect(failures[0]).To(ContainSubstring("does not verify against the service key CA"))
+	})
+
+	It("reports a version the server refuses as not supported", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		probe, err := client.ProbeTLS(ctx, "tlsv1.1")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(probe.Supported).To(BeFalse())
+	})
+
+	It("reports a version above the server's maximum as not supported", func() {
+		listener.Close()
+		listen(tls.VersionTLS12, tls.VersionTLS12)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		probe, err := client.ProbeTLS(ctx, "tlsv1.3")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(probe.Supported).To(BeFalse())
+		Expect(probe.Err).To(MatchError(ContainSubstring("server negotiated tlsv1.2")))
+	})
+
+	It("warns that the chain is not verified when the service key has no CA", func() {
+		Expect(client.TLSWarning()).To(BeEmpty())
+
+		credentials.TLS_CA_Cert = ""
+
+		Expect(client.TLSWarning()).To(ContainSubstring("no tls_ca_cert"))
+		Expect(client.TLSWarning()).To(ContainSubstring(client.TLS().Address()))
+	})
+
+	Context("when the server drops the connection before the handshake", func() {
+		BeforeEach(func() {
+			listener.Close()
+
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			credentials.TLS_Port = listener.Addr().(*net.TCPAddr).Port
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+		})
+
+		It("returns an error rather than reporting the version unsupported", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			probe, err := client.ProbeTLS(ctx, "tlsv1.2")
+
+			Expect(err).To(HaveOccurred())
+			Expect(probe.Supported).To(BeFalse())
+		})
+
+		It("fails the probe instead of reporting a mismatch", func() {
+			credentials.TLS_Versions = []string{"tlsv1.2", "tlsv1.3"}
+
+			client.AssertTLSVersions()()
+
+			Expect(failures).To(ConsistOf(haveFailure(failreason.TLSProbeFailed, "Failed to probe tlsv1 on the TLS port")))
+		})
+	})
+
+	It("reports the negotiated cipher suite", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		probe, err := client.ProbeTLS(ctx, "tlsv1.3")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(probe.Supported).To(BeTrue())
+		Expect(probe.CipherSuite).To(HavePrefix("TLS_"))
+	})
+})
+
+func selfSignedCertificate() (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
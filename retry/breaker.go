@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	// BreakerClosed lets every operation through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen short-circuits every operation until the cool-down passes
+	BreakerOpen
+	// BreakerHalfOpen lets a single operation through to probe for recovery
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is a circuit breaker shared between retried operations against the
+// same dependency. It opens after threshold consecutive operations exhaust
+// their retries, and half-opens after coolDown to let one operation probe
+// whether the dependency has recovered.
+type Breaker struct {
+	lock      sync.Mutex
+	threshold int
+	coolDown  time.Duration
+	reason    string
+	now       func() time.Time
+
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a closed Breaker. reason is the failure message used
+// when an operation is short-circuited.
+func NewBreaker(threshold int, coolDown time.Duration, reason string) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		reason:    reason,
+		now:       time.Now,
+	}
+}
+
+// WithClock replaces the breaker's source of time, for tests
+func (b *Breaker) WithClock(now func() time.Time) *Breaker {
+	b.now = now
+	return b
+}
+
+// BreakerOpenError is the Err of an *Error when an operation was
+// short-circuited by an open Breaker
+type BreakerOpenError struct {
+	Reason     string
+	Failures   int
+	RetryAfter time.Duration
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf(
+		"circuit breaker open after %d consecutive failed operations, next probe in %s",
+		e.Failures, e.RetryAfter.Round(time.Second),
+	)
+}
+
+// State reports the state of the breaker, half-opening it if the cool-down has passed
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.coolOff()
+	return b.state
+}
+
+// Allow returns a *BreakerOpenError if an operation must not run
+func (b *Breaker) Allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.coolOff()
+
+	switch {
+	case b.state == BreakerClosed:
+		return nil
+	case b.state == BreakerHalfOpen && !b.probing:
+		b.probing = true
+		return nil
+	default:
+		return &BreakerOpenError{
+			Reason:     b.reason,
+			Failures:   b.failures,
+			RetryAfter: b.coolDown - b.now().Sub(b.openedAt),
+		}
+	}
+}
+
+// Success records an operation that succeeded, closing the breaker
+func (b *Breaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records an operation that exhausted its retries, opening the
+// breaker once the threshold is reached or when a probe fails
+func (b *Breaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+	b.probing = false
+}
+
+func (b *Breaker) coolOff() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.coolDown {
+		b.state = BreakerHalfOpen
+	}
+}
@@ -0,0 +1,98 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("Breaker", func() {
+	var (
+		now     time.Time
+		breaker *retry.Breaker
+		policy  retry.Policy
+	)
+
+	BeforeEach(func() {
+		attempts = 0
+		now = time.Now()
+		breaker = retry.NewBreaker(2, time.Minute, "API unavailable").WithClock(func() time.Time {
+			return now
+		})
+		policy = retry.Policy{
+			SessionTimeout: time.Second,
+			Backoff:        retry.None(time.Millisecond),
+			MaxRetries:     1,
+			Breaker:        breaker,
+		}
+	})
+
+	It("opens after the threshold of consecutive failed operations", func() {
+		policy.Run(context.Background(), failureFn, retry.Succeeds)
+		Expect(breaker.State()).To(Equal(retry.BreakerClosed))
+
+		policy.Run(context.Background(), failureFn, retry.Succeeds)
+		Expect(breaker.State()).To(Equal(retry.BreakerOpen))
+	})
+
+	It("resets the count when an operation succeeds", func() {
+		policy.Run(context.Background(), failureFn, retry.Succeeds)
+		policy.Run(context.Background(), successFn, retry.Succeeds)
+		policy.Run(context.Background(), failureFn, retry.Succeeds)
+
+		Expect(breaker.State()).To(Equal(retry.BreakerClosed))
+	})
+
+	Context("when open", func() {
+		BeforeEach(func() {
+			breaker.Failure()
+			breaker.Failure()
+			attempts = 0
+		})
+
+		It("short-circuits operations without attempting them", func() {
+			err := policy.Run(context.Background(), successFn, retry.Succeeds)
+
+			var open *retry.BreakerOpenError
+			Expect(errors.As(err, &open)).To(BeTrue())
+			Expect(open.Reason).To(Equal("API unavailable"))
+			Expect(attempts).To(BeZero())
+		})
+
+		It("fails the fluent builder with the breaker's reason", func() {
+			var message string
+			retry.Session(successFn).AndBreaker(breaker).AndFailHandler(func(msg string, i ...int) {
+				message = msg
+			}).Until(retry.Succeeds, "generic failure")
+
+			Expect(message).To(HavePrefix("API unavailable"))
+		})
+
+		Context("after the cool-down", func() {
+			BeforeEach(func() {
+				now = now.Add(time.Minute)
+			})
+
+			It("half-opens and lets a single probe through", func() {
+				Expect(breaker.State()).To(Equal(retry.BreakerHalfOpen))
+				Expect(breaker.Allow()).To(Succeed())
+				Expect(breaker.Allow()).NotTo(Succeed())
+			})
+
+			It("closes when the probe succeeds", func() {
+				Expect(policy.Run(context.Background(), successFn, retry.Succeeds)).To(Succeed())
+				Expect(breaker.State()).To(Equal(retry.BreakerClosed))
+			})
+
+			It("reopens when the probe fails", func() {
+				policy.Run(context.Background(), failureFn, retry.Succeeds)
+				Expect(breaker.State()).To(Equal(retry.BreakerOpen))
+			})
+		})
+	})
+})
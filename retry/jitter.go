@@ -0,0 +1,124 @@
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Random is the source of randomness used by the jittered backoffs.
+// A *rand.Rand satisfies it, but is not safe for concurrent use; see NewRandom.
+type Random interface {
+	Int63n(n int64) int64
+}
+
+// NewRandom returns a Random seeded with seed that is safe for concurrent use
+func NewRandom(seed int64) Random {
+	return &lockedRandom{rand: rand.New(rand.NewSource(seed))}
+}
+
+type lockedRandom struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *lockedRandom) Int63n(n int64) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Int63n(n)
+}
+
+// FullJitter sleeps for a random duration between zero and the exponential
+// backoff for the retry
+func FullJitter(baseline time.Duration, random Random) Backoff {
+	return func(retryCount uint) time.Duration {
+		if retryCount == 0 {
+			return 0
+		}
+
+		return between(random, 0, exponential(baseline, retryCount))
+	}
+}
+
+// EqualJitter sleeps for half of the exponential backoff for the retry plus
+// a random duration of up to the other half
+func EqualJitter(baseline time.Duration, random Random) Backoff {
+	return func(retryCount uint) time.Duration {
+		if retryCount == 0 {
+			return 0
+		}
+
+		half := exponential(baseline, retryCount) / 2
+		return half + between(random, 0, half)
+	}
+}
+
+// DecorrelatedJitter sleeps for a random duration between the baseline and
+// three times the previous sleep. The sequence restarts whenever it is asked
+// for the backoff of the first attempt.
+func DecorrelatedJitter(baseline time.Duration, random Random) Backoff {
+	var (
+		lock     sync.Mutex
+		previous = baseline
+	)
+
+	return func(retryCount uint) time.Duration {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if retryCount == 0 {
+			previous = baseline
+			return 0
+		}
+
+		upper := previous * 3
+		if upper/3 != previous {
+			upper = math.MaxInt64
+		}
+
+		previous = between(random, baseline, upper)
+		return previous
+	}
+}
+
+// Capped keeps the backoff b between min and max. A max of zero leaves the
+// backoff uncapped. The first attempt is never delayed.
+func Capped(b Backoff, min, max time.Duration) Backoff {
+	return func(retryCount uint) time.Duration {
+		backoff := b(retryCount)
+		if retryCount == 0 {
+			return backoff
+		}
+
+		if max > 0 && backoff > max {
+			backoff = max
+		}
+		if backoff < min {
+			backoff = min
+		}
+		return backoff
+	}
+}
+
+// exponential is baseline * 2^retryCount, saturating instead of overflowing
+func exponential(baseline time.Duration, retryCount uint) time.Duration {
+	backoff := float64(baseline) * math.Pow(2, float64(retryCount))
+	if backoff >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(backoff)
+}
+
+// between returns a random duration in [lower, upper]
+func between(random Random, lower, upper time.Duration) time.Duration {
+	if upper <= lower {
+		return lower
+	}
+
+	span := int64(upper - lower)
+	if span == math.MaxInt64 {
+		return lower + time.Duration(random.Int63n(span))
+	}
+	return lower + time.Duration(random.Int63n(span+1))
+}
@@ -0,0 +1,103 @@
+package retry_test
+
+import (
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("Jittered backoff", func() {
+	var baseline = 100 * time.Millisecond
+
+	sequence := func(backoff retry.Backoff, n int) []time.Duration {
+		var sleeps []time.Duration
+		for i := 0; i < n; i++ {
+			sleeps = append(sleeps, backoff(uint(i)))
+		}
+		return sleeps
+	}
+
+	Describe("FullJitter", func() {
+		It("stays between zero and the exponential backoff", func() {
+			backoff := retry.FullJitter(baseline, retry.NewRandom(1))
+
+			Expect(backoff(0)).To(BeZero())
+			for i := 1; i < 10; i++ {
+				Expect(backoff(uint(i))).To(BeNumerically("<=", time.Duration(math.Pow(2, float64(i)))*baseline))
+			}
+		})
+
+		It("is deterministic for a given seed", func() {
+			first := sequence(retry.FullJitter(baseline, retry.NewRandom(42)), 10)
+			second := sequence(retry.FullJitter(baseline, retry.NewRandom(42)), 10)
+			other := sequence(retry.FullJitter(baseline, retry.NewRandom(43)), 10)
+
+			Expect(first).To(Equal(second))
+			Expect(first).NotTo(Equal(other))
+		})
+
+		It("does not overflow for large retry counts", func() {
+			backoff := retry.FullJitter(time.Second, retry.NewRandom(1))
+			Expect(backoff(100)).To(BeNumerically(">=", 0))
+		})
+	})
+
+	Describe("EqualJitter", func() {
+		It("stays between half and all of the exponential backoff", func() {
+			backoff := retry.EqualJitter(baseline, retry.NewRandom(1))
+
+			Expect(backoff(0)).To(BeZero())
+			for i := 1; i < 10; i++ {
+				exponential := time.Duration(math.Pow(2, float64(i))) * baseline
+				Expect(backoff(uint(i))).To(BeNumerically(">=", exponential/2))
+				Expect(backoff(uint(i))).To(BeNumerically("<=", exponential))
+			}
+		})
+	})
+
+	Describe("DecorrelatedJitter", func() {
+		It("stays between the baseline and three times the previous sleep", func() {
+			backoff := retry.DecorrelatedJitter(baseline, retry.NewRandom(1))
+
+			Expect(backoff(0)).To(BeZero())
+			previous := baseline
+			for i := 1; i < 10; i++ {
+				sleep := backoff(uint(i))
+				Expect(sleep).To(BeNumerically(">=", baseline))
+				Expect(sleep).To(BeNumerically("<=", previous*3))
+				previous = sleep
+			}
+		})
+
+		It("restarts the sequence from the first attempt", func() {
+			backoff := retry.DecorrelatedJitter(baseline, retry.NewRandom(7))
+			sequence(backoff, 20)
+
+			Expect(backoff(0)).To(BeZero())
+			Expect(backoff(1)).To(BeNumerically("<=", baseline*3))
+		})
+	})
+
+	Describe("Capped", func() {
+		It("limits the backoff to the maximum", func() {
+			backoff := retry.Capped(retry.Exponential(time.Second), 0, time.Minute)
+
+			Expect(backoff(0)).To(BeZero())
+			Expect(backoff(2)).To(Equal(4 * time.Second))
+			Expect(backoff(10)).To(Equal(time.Minute))
+		})
+
+		It("raises the backoff to the minimum without delaying the first attempt", func() {
+			backoff := retry.Capped(retry.FullJitter(time.Millisecond, retry.NewRandom(1)), time.Second, 0)
+
+			Expect(backoff(0)).To(BeZero())
+			for i := 1; i < 5; i++ {
+				Expect(backoff(uint(i))).To(Equal(time.Second))
+			}
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package retry
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Observer is notified before and after every attempt of a retried operation
+type Observer interface {
+	BeforeAttempt(number int, slept time.Duration)
+	AfterAttempt(attempt Attempt)
+}
+
+func (p Policy) beforeAttempt(number int, slept time.Duration) {
+	for _, o := range p.Observers {
+		o.BeforeAttempt(number, slept)
+	}
+}
+
+func (p Policy) afterAttempt(attempt Attempt) {
+	for _, o := range p.Observers {
+		o.AfterAttempt(attempt)
+	}
+}
+
+// History is an Observer that keeps every attempt it is notified of
+type History struct {
+	lock     sync.Mutex
+	attempts []Attempt
+}
+
+func (h *History) BeforeAttempt(number int, slept time.Duration) {}
+
+func (h *History) AfterAttempt(attempt Attempt) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.attempts = append(h.attempts, attempt)
+}
+
+// Attempts returns the attempts observed so far, in order
+func (h *History) Attempts() []Attempt {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]Attempt(nil), h.attempts...)
+}
+
+// Reason summarises why an attempt failed: its error, or otherwise its exit
+// code and the last line it printed
+func (a Attempt) Reason() string {
+	if a.Succeeded {
+		return "succeeded"
+	}
+
+	if a.Err != nil {
+		return a.Err.Error()
+	}
+
+	reason := fmt.Sprintf("exit code %d", a.ExitCode)
+	if line := lastLine(a.Stderr); line != "" {
+		reason += ": " + line
+	} else if line := lastLine(a.Stdout); line != "" {
+		reason += ": " + line
+	}
+	return reason
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,87 @@
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+type countingObserver struct {
+	before []int
+	after  []retry.Attempt
+}
+
+func (o *countingObserver) BeforeAttempt(number int, slept time.Duration) {
+	o.before = append(o.before, number)
+}
+
+func (o *countingObserver) AfterAttempt(attempt retry.Attempt) {
+	o.after = append(o.after, attempt)
+}
+
+var _ = Describe("Observer", func() {
+	var policy retry.Policy
+
+	BeforeEach(func() {
+		attempts = 0
+		policy = retry.Policy{
+			SessionTimeout: time.Second,
+			Backoff:        retry.None(time.Millisecond),
+			MaxRetries:     2,
+		}
+	})
+
+	It("is notified before and after each attempt", func() {
+		observer := new(countingObserver)
+		policy.Observers = []retry.Observer{observer}
+
+		policy.Run(context.Background(), failureFn, retry.Succeeds)
+
+		Expect(observer.before).To(Equal([]int{1, 2, 3}))
+		Expect(observer.after).To(HaveLen(3))
+		Expect(observer.after[1].Slept).To(Equal(time.Millisecond))
+		Expect(observer.after[2].ExitCode).NotTo(BeZero())
+		Expect(observer.after[2].Stderr).To(ContainSubstring("not-a-file-that-exists"))
+		Expect(observer.after[2].Succeeded).To(BeFalse())
+		Expect(observer.after[2].Reason()).To(MatchRegexp(`exit code \d+: .*not-a-file-that-exists`))
+	})
+
+	It("can be attached to the fluent builder", func() {
+		observer := new(countingObserver)
+
+		retry.Session(successFn).WithMaxRetries(2).AndBackoff(retry.None(time.Millisecond)).AndObserver(observer).Until(retry.Succeeds)
+
+		Expect(observer.after).To(HaveLen(1))
+		Expect(observer.after[0].Succeeded).To(BeTrue())
+	})
+
+	It("ignores a nil observer given to the fluent builder", func() {
+		Expect(func() {
+			retry.Session(successFn).WithMaxRetries(2).AndObserver(nil).Until(retry.Succeeds)
+		}).NotTo(Panic())
+	})
+
+	It("is not told about the attempts of other policies", func() {
+		observed := new(retry.History)
+		policy.Observers = []retry.Observer{observed}
+		other := retry.Policy{Backoff: retry.None(time.Millisecond), MaxRetries: 2}
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			other.Do(context.Background(), func(context.Context) (interface{}, error) {
+				return nil, nil
+			}, retry.NoError)
+		}()
+		policy.Run(context.Background(), successFn, retry.Succeeds)
+		<-done
+
+		Expect(observed.Attempts()).To(HaveLen(1))
+		Expect(observed.Attempts()[0].ExitCode).To(BeZero())
+	})
+})
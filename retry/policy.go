@@ -0,0 +1,367 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega/gexec"
+)
+
+// outputTail is the number of bytes of stdout/stderr kept on an Error
+const outputTail = 2048
+
+// Policy describes how an operation is retried. Unlike the fluent builder
+// returned by Session it never calls a fail handler, so it can be used
+// outside of a running Ginkgo suite.
+type Policy struct {
+	SessionTimeout time.Duration
+	Backoff        Backoff
+	MaxRetries     int
+
+	// Budget bounds the total time spent on all attempts and backoffs. A
+	// backoff that would outlast it is cut short for one final attempt.
+	// Zero means retries are only bounded by MaxRetries.
+	Budget time.Duration
+
+	// Observers are notified of every attempt of this policy's operations,
+	// and of no others
+	Observers []Observer
+
+	// Classifier, when set, stops retrying as soon as an attempt fails in a
+	// way that retrying cannot fix
+	Classifier Classifier
+
+	// Breaker, when set, short-circuits the operation while it is open and
+	// is told whether the operation as a whole succeeded
+	Breaker *Breaker
+}
+
+// Classifier inspects a failed attempt and reports whether it is fatal,
+// along with the reason to report
+type Classifier func(result interface{}, err error) (reason string, fatal bool)
+
+// FatalError is the Err of an *Error when a Classifier judged an attempt fatal
+type FatalError struct {
+	Reason string
+}
+
+func (e *FatalError) Error() string {
+	return "fatal: " + e.Reason
+}
+
+// ErrBudgetExhausted is the Err of an *Error when retrying stopped because
+// the Policy's Budget ran out
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// Attempt records a single try of an operation
+type Attempt struct {
+	Number    int
+	Slept     time.Duration
+	Duration  time.Duration
+	Succeeded bool
+
+	// Err is the error returned by the attempt, if any
+	Err error
+
+	// ExitCode, Stdout and Stderr are only set when the attempt ran a *gexec.Session
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// DefaultPolicy matches the defaults of retry.Session
+func DefaultPolicy() Policy {
+	return Policy{
+		SessionTimeout: time.Second,
+		Backoff:        None(time.Second),
+		MaxRetries:     10,
+	}
+}
+
+// Operation is a single attempt at something that may need retrying, such as
+// an HTTP request or a Redis command
+type Operation func(ctx context.Context) (interface{}, error)
+
+// Predicate decides whether the outcome of an attempt is acceptable
+type Predicate func(result interface{}, err error) bool
+
+// NoError is satisfied by any attempt that did not return an error
+func NoError(result interface{}, err error) bool {
+	return err == nil
+}
+
+// Error describes the last attempt of an operation that never satisfied its condition
+type Error struct {
+	Attempts int
+	Elapsed  time.Duration
+	Budget   time.Duration
+	History  []Attempt
+
+	// Result and Cause are what the last attempt returned
+	Result interface{}
+	Cause  error
+
+	// ExitCode, Stdout and Stderr are only set when the result was a *gexec.Session
+	ExitCode int
+	Stdout   string
+	Stderr   string
+
+	// Err is set when the context was cancelled or its deadline passed
+	Err error
+}
+
+func (e *Error) Error() string {
+	var msg string
+	if e.Err != nil {
+		msg = fmt.Sprintf("retry stopped after %d attempts in %s: %s", e.Attempts, e.Elapsed, e.Err)
+	} else {
+		msg = fmt.Sprintf("exceeded %d retries in %s", e.Attempts-1, e.Elapsed)
+	}
+
+	if _, ok := e.Result.(*gexec.Session); ok {
+		msg += fmt.Sprintf(" (last exit code %d)", e.ExitCode)
+	}
+
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	} else if output := strings.TrimSpace(e.Stderr); output != "" {
+		msg += ": " + output
+	} else if output := strings.TrimSpace(e.Stdout); output != "" {
+		msg += ": " + output
+	}
+
+	if e.Budget > 0 {
+		msg += "\n" + e.BudgetReport()
+	}
+
+	return msg
+}
+
+// BudgetReport describes how much of the Budget each attempt consumed,
+// counting the backoff slept before it
+func (e *Error) BudgetReport() string {
+	shares := make([]string, 0, len(e.History))
+	for _, attempt := range e.History {
+		spent := attempt.Slept + attempt.Duration
+		shares = append(shares, fmt.Sprintf(
+			"attempt %d: %s (%.1f%%)",
+			attempt.Number, spent.Round(time.Millisecond), 100*float64(spent)/float64(e.Budget),
+		))
+	}
+
+	return fmt.Sprintf("budget %s: %s", e.Budget, strings.Join(shares, ", "))
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run retries the session provided by sp until c is satisfied. It returns nil
+// on success and an *Error describing the last attempt otherwise. Cancelling
+// ctx interrupts both the backoff sleep and a running session.
+func (p Policy) Run(ctx context.Context, sp sessionProvider, c Condition) error {
+	op := func(ctx context.Context) (interface{}, error) {
+		session := sp()
+		wait(ctx, session, p.SessionTimeout)
+		return session, nil
+	}
+
+	until := func(result interface{}, err error) bool {
+		return err == nil && c(result.(*gexec.Session))
+	}
+
+	_, err := p.Do(ctx, op, until)
+	return err
+}
+
+// Do retries op until its outcome satisfies until, returning the accepted
+// result. SessionTimeout bounds each attempt through its context.
+func (p Policy) Do(ctx context.Context, op Operation, until Predicate) (interface{}, error) {
+	if p.Breaker == nil {
+		return p.do(ctx, op, until)
+	}
+
+	if err := p.Breaker.Allow(); err != nil {
+		return nil, &Error{Err: err}
+	}
+
+	value, err := p.do(ctx, op, until)
+
+	var fatal *FatalError
+	if err == nil || errors.As(err, &fatal) {
+		// a fatal failure still means the dependency answered
+		p.Breaker.Success()
+	} else {
+		p.Breaker.Failure()
+	}
+
+	return value, err
+}
+
+func (p Policy) do(ctx context.Context, op Operation, until Predicate) (interface{}, error) {
+	start := time.Now()
+	result := &Error{Budget: p.Budget}
+
+	budgetCtx := ctx
+	if p.Budget > 0 {
+		var cancel context.CancelFunc
+		budgetCtx, cancel = context.WithTimeout(ctx, p.Budget)
+		defer cancel()
+	}
+
+	for retry := 0; retry <= p.MaxRetries; retry++ {
+		backoff := p.backoff(uint(retry))
+
+		// attempts run within the budget, except for a final one made as the
+		// budget runs out, which only its SessionTimeout bounds
+		attemptCtx, final := budgetCtx, false
+		if p.Budget > 0 {
+			remaining := p.Budget - time.Since(start)
+			if remaining <= 0 {
+				result.Err = ErrBudgetExhausted
+				break
+			}
+			if backoff >= remaining {
+				backoff, attemptCtx, final = remaining, ctx, true
+			}
+		}
+
+		if err := sleep(attemptCtx, backoff); err != nil {
+			result.Err = p.stopReason(ctx, err)
+			break
+		}
+
+		result.Attempts++
+		p.beforeAttempt(result.Attempts, backoff)
+
+		attemptStart := time.Now()
+		value, err := p.attempt(attemptCtx, op)
+		attempt := newAttempt(result.Attempts, backoff, time.Since(attemptStart), value, err)
+		attempt.Succeeded = until(value, err)
+
+		result.record(value, attempt)
+		p.afterAttempt(attempt)
+
+		if attempt.Succeeded {
+			return value, nil
+		}
+
+		if p.Classifier != nil {
+			if reason, fatal := p.Classifier(value, err); fatal {
+				result.Err = &FatalError{Reason: reason}
+				break
+			}
+		}
+
+		if final {
+			result.Err = p.stopReason(ctx, context.DeadlineExceeded)
+			break
+		}
+
+		if err := budgetCtx.Err(); err != nil {
+			result.Err = p.stopReason(ctx, err)
+			break
+		}
+	}
+
+	result.Elapsed = time.Since(start)
+	return nil, result
+}
+
+// stopReason tells apart the caller's context ending from the budget running out
+func (p Policy) stopReason(ctx context.Context, err error) error {
+	if ctx.Err() == nil && p.Budget > 0 {
+		return ErrBudgetExhausted
+	}
+	return err
+}
+
+func (p Policy) attempt(ctx context.Context, op Operation) (interface{}, error) {
+	if p.SessionTimeout <= 0 {
+		return op(ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, p.SessionTimeout)
+	defer cancel()
+	return op(attemptCtx)
+}
+
+func (p Policy) backoff(retryCount uint) time.Duration {
+	if p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff(retryCount)
+}
+
+func newAttempt(number int, slept, duration time.Duration, value interface{}, err error) Attempt {
+	attempt := Attempt{
+		Number:   number,
+		Slept:    slept,
+		Duration: duration,
+		Err:      err,
+	}
+
+	if session, ok := value.(*gexec.Session); ok {
+		attempt.ExitCode = session.ExitCode()
+		attempt.Stdout = tail(session.Out.Contents())
+		attempt.Stderr = tail(session.Err.Contents())
+	}
+
+	return attempt
+}
+
+func (e *Error) record(value interface{}, attempt Attempt) {
+	e.Result = value
+	e.Cause = attempt.Err
+	e.ExitCode = attempt.ExitCode
+	e.Stdout = attempt.Stdout
+	e.Stderr = attempt.Stderr
+	e.History = append(e.History, attempt)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait blocks until the session exits, killing it if the timeout passes or
+// the context is cancelled first. A timeout of zero or less never passes.
+func wait(ctx context.Context, session *gexec.Session, timeout time.Duration) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-session.Exited:
+		return
+	case <-expired:
+	case <-ctx.Done():
+	}
+
+	session.Kill()
+	<-session.Exited
+}
+
+func tail(output []byte) string {
+	if len(output) > outputTail {
+		output = output[len(output)-outputTail:]
+	}
+	return string(output)
+}
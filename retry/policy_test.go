@@ -0,0 +1,255 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+func SleepingSession() *gexec.Session {
+	cmd := exec.Command("sleep", "10")
+	s, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	Expect(err).NotTo(HaveOccurred())
+	return s
+}
+
+var _ = Describe("Policy", func() {
+	var policy retry.Policy
+
+	BeforeEach(func() {
+		attempts = 0
+		policy = retry.Policy{
+			SessionTimeout: time.Second,
+			Backoff:        retry.None(time.Millisecond),
+			MaxRetries:     3,
+		}
+	})
+
+	Context("when the session succeeds", func() {
+		It("returns no error", func() {
+			err := policy.Run(context.Background(), successFn, retry.Succeeds)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(1))
+		})
+	})
+
+	Context("when the session always fails", func() {
+		It("returns an error describing the last attempt", func() {
+			err := policy.Run(context.Background(), failureFn, retry.Succeeds)
+			Expect(attempts).To(Equal(4))
+
+			var retryErr *retry.Error
+			Expect(errors.As(err, &retryErr)).To(BeTrue())
+			Expect(retryErr.Attempts).To(Equal(4))
+			Expect(retryErr.ExitCode).NotTo(BeZero())
+			Expect(retryErr.Stderr).To(ContainSubstring("not-a-file-that-exists"))
+			Expect(retryErr.Elapsed).To(BeNumerically(">", 0))
+			Expect(retryErr.Err).To(BeNil())
+			Expect(err.Error()).To(ContainSubstring("exceeded 3 retries"))
+		})
+	})
+
+	Context("when the context is cancelled while backing off", func() {
+		It("stops without waiting for the backoff", func() {
+			policy.Backoff = retry.None(time.Hour)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := policy.Run(ctx, failureFn, retry.Succeeds)
+
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(attempts).To(Equal(1))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		})
+	})
+
+	Context("when the session outlives its timeout", func() {
+		It("kills the session and retries", func() {
+			policy.SessionTimeout = 50 * time.Millisecond
+			policy.MaxRetries = 1
+
+			sleepFn := func() *gexec.Session {
+				attempts++
+				return SleepingSession()
+			}
+
+			start := time.Now()
+			err := policy.Run(context.Background(), sleepFn, retry.Succeeds)
+
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(attempts).To(Equal(2))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when there is no session timeout", func() {
+		It("waits for the session to exit", func() {
+			policy.SessionTimeout = 0
+
+			shortSleepFn := func() *gexec.Session {
+				attempts++
+				s, err := gexec.Start(exec.Command("sleep", "0.2"), GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				return s
+			}
+
+			err := policy.Run(context.Background(), shortSleepFn, retry.Succeeds)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(1))
+		})
+	})
+
+	Describe("Do", func() {
+		var errNotYet = errors.New("not yet")
+
+		It("returns the first acceptable result", func() {
+			op := func(ctx context.Context) (interface{}, error) {
+				attempts++
+				if attempts < 3 {
+					return nil, errNotYet
+				}
+				return attempts, nil
+			}
+
+			result, err := policy.Do(context.Background(), op, retry.NoError)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(3))
+		})
+
+		It("retries until the predicate accepts the result", func() {
+			op := func(ctx context.Context) (interface{}, error) {
+				attempts++
+				return attempts, nil
+			}
+			atLeastTwo := func(result interface{}, err error) bool {
+				return err == nil && result.(int) >= 2
+			}
+
+			result, err := policy.Do(context.Background(), op, atLeastTwo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(2))
+		})
+
+		It("reports the last result and error when retries are exhausted", func() {
+			op := func(ctx context.Context) (interface{}, error) {
+				attempts++
+				return attempts, errNotYet
+			}
+
+			_, err := policy.Do(context.Background(), op, retry.NoError)
+
+			var retryErr *retry.Error
+			Expect(errors.As(err, &retryErr)).To(BeTrue())
+			Expect(retryErr.Attempts).To(Equal(4))
+			Expect(retryErr.Result).To(Equal(4))
+			Expect(retryErr.Cause).To(Equal(errNotYet))
+			Expect(err.Error()).To(ContainSubstring("not yet"))
+		})
+
+		It("bounds each attempt by the session timeout", func() {
+			policy.SessionTimeout = 10 * time.Millisecond
+			policy.MaxRetries = 0
+
+			op := func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+
+			_, err := policy.Do(context.Background(), op, retry.NoError)
+			Expect(err.(*retry.Error).Cause).To(Equal(context.DeadlineExceeded))
+		})
+	})
+	Describe("Classifier", func() {
+		It("returns a FatalError as soon as an attempt is classified fatal", func() {
+			policy.Classifier = func(result interface{}, err error) (string, bool) {
+				return "no point retrying", true
+			}
+
+			err := policy.Run(context.Background(), failureFn, retry.Succeeds)
+
+			var fatal *retry.FatalError
+			Expect(errors.As(err, &fatal)).To(BeTrue())
+			Expect(fatal.Reason).To(Equal("no point retrying"))
+			Expect(attempts).To(Equal(1))
+		})
+	})
+
+	Describe("Budget", func() {
+		BeforeEach(func() {
+			policy.MaxRetries = 1000
+			policy.Backoff = retry.None(20 * time.Millisecond)
+			policy.Budget = 100 * time.Millisecond
+		})
+
+		It("stops retrying once the budget is exhausted", func() {
+			start := time.Now()
+			err := policy.Run(context.Background(), failureFn, retry.Succeeds)
+
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(attempts).To(BeNumerically("<", 10))
+			Expect(errors.Is(err, retry.ErrBudgetExhausted)).To(BeTrue())
+		})
+
+		It("records how much of the budget each attempt consumed", func() {
+			err := policy.Run(context.Background(), failureFn, retry.Succeeds)
+
+			retryErr := err.(*retry.Error)
+			Expect(retryErr.Budget).To(Equal(100 * time.Millisecond))
+			Expect(retryErr.History).To(HaveLen(retryErr.Attempts))
+			Expect(retryErr.History[0].Number).To(Equal(1))
+			Expect(retryErr.History[0].Slept).To(BeZero())
+			Expect(retryErr.History[1].Slept).To(Equal(20 * time.Millisecond))
+			Expect(retryErr.BudgetReport()).To(ContainSubstring("attempt 1: "))
+			Expect(err.Error()).To(ContainSubstring("budget 100ms"))
+		})
+
+		It("does not sleep past the budget, making a final attempt as it runs out", func() {
+			policy.Backoff = retry.None(time.Hour)
+
+			start := time.Now()
+			err := policy.Run(context.Background(), failureFn, retry.Succeeds)
+
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(attempts).To(Equal(2))
+			Expect(errors.Is(err, retry.ErrBudgetExhausted)).To(BeTrue())
+
+			retryErr := err.(*retry.Error)
+			Expect(retryErr.History[1].Slept).To(BeNumerically("<=", 100*time.Millisecond))
+		})
+
+		It("accepts a final attempt made as the budget runs out", func() {
+			policy.Backoff = retry.None(time.Hour)
+
+			calls := 0
+			_, err := policy.Do(context.Background(), func(ctx context.Context) (interface{}, error) {
+				calls++
+				if calls == 1 {
+					return nil, errors.New("not yet")
+				}
+				return nil, ctx.Err()
+			}, retry.NoError)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(Equal(2))
+		})
+
+		It("reports the budget in the default fail message", func() {
+			var message string
+			retry.Session(failureFn).WithMaxRetries(1000).AndBackoff(retry.None(20 * time.Millisecond)).AndBudget(100 * time.Millisecond).AndFailHandler(func(msg string, i ...int) {
+				message = msg
+			}).Until(retry.Succeeds)
+
+			Expect(message).To(HavePrefix("Exceeded retry budget of 100ms"))
+		})
+	})
+})
@@ -1,6 +1,8 @@
 package retry
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"regexp"
@@ -16,6 +18,10 @@ type retryCheck struct {
 	failHandler     failHandler
 	backoff         Backoff
 	maxRetries      int
+	budget          time.Duration
+	observers       []Observer
+	aborts          []Abort
+	breaker         *Breaker
 }
 
 func Session(sp sessionProvider) *retryCheck {
@@ -64,16 +70,52 @@ func (rc *retryCheck) AndBackoff(b Backoff) *retryCheck {
 	return rc.WithBackoff(b)
 }
 
-func (rc *retryCheck) Until(c Condition, msg ...string) {
-	if rc.check(c) {
-		return
-	}
+// WithBudget stops retrying once the total time spent reaches budget,
+// even if retries remain
+func (rc *retryCheck) WithBudget(budget time.Duration) *retryCheck {
+	rc.budget = budget
+	return rc
+}
 
-	if len(msg) == 0 {
-		msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
+func (rc *retryCheck) AndBudget(budget time.Duration) *retryCheck {
+	return rc.WithBudget(budget)
+}
+
+// WithObserver notifies o of every attempt; a nil observer is ignored
+func (rc *retryCheck) WithObserver(o Observer) *retryCheck {
+	if o != nil {
+		rc.observers = append(rc.observers, o)
 	}
+	return rc
+}
 
-	rc.failHandler(msg[0])
+func (rc *retryCheck) AndObserver(o Observer) *retryCheck {
+	return rc.WithObserver(o)
+}
+
+// WithAbort stops retrying as soon as one of the aborts matches a failed
+// session, failing with its reason instead of the Until message
+func (rc *retryCheck) WithAbort(aborts ...Abort) *retryCheck {
+	rc.aborts = append(rc.aborts, aborts...)
+	return rc
+}
+
+func (rc *retryCheck) AndAbort(aborts ...Abort) *retryCheck {
+	return rc.WithAbort(aborts...)
+}
+
+// WithBreaker shares b with other operations; a nil breaker is ignored
+func (rc *retryCheck) WithBreaker(b *Breaker) *retryCheck {
+	rc.breaker = b
+	return rc
+}
+
+func (rc *retryCheck) AndBreaker(b *Breaker) *retryCheck {
+	return rc.WithBreaker(b)
+}
+
+func (rc *retryCheck) Until(c Condition, msg ...string) {
+	rc.run(c, msg...)
 }
 
 func (rc *retryCheck) UntilAny(c []Condition, msg ...string) {
@@ -82,15 +124,7 @@ func (rc *retryCheck) UntilAny(c []Condition, msg ...string) {
 		return
 	}
 
-	if rc.checkAny(c...) {
-		return
-	}
-
-	if len(msg) == 0 {
-		msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
-	}
-
-	rc.failHandler(msg[0])
+	rc.run(Any(c...), msg...)
 }
 
 func (rc *retryCheck) UntilAll(c []Condition, msg ...string) {
@@ -99,65 +133,106 @@ func (rc *retryCheck) UntilAll(c []Condition, msg ...string) {
 		return
 	}
 
-	if rc.checkAll(c...) {
+	rc.run(All(c...), msg...)
+}
+
+func (rc *retryCheck) run(c Condition, msg ...string) {
+	err := rc.policy().Run(context.Background(), rc.sessionProvider, c)
+	if err == nil {
 		return
 	}
 
+	var (
+		fatal *FatalError
+		open  *BreakerOpenError
+	)
+	switch {
+	case errors.As(err, &fatal):
+		msg = []string{fatal.Reason}
+	case errors.As(err, &open):
+		msg = []string{open.Reason}
+	}
+
 	if len(msg) == 0 {
-		msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
+		if errors.Is(err, ErrBudgetExhausted) {
+			msg = []string{fmt.Sprintf("Exceeded retry budget of %s", rc.budget)}
+		} else {
+			msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
+		}
 	}
 
-	rc.failHandler(msg[0])
+	rc.failHandler(fmt.Sprintf("%s\n%s", msg[0], err))
 }
 
-func (rc *retryCheck) check(c Condition) bool {
-	for retry := 0; retry <= rc.maxRetries; retry++ {
-		time.Sleep(rc.backoff(uint(retry)))
+func (rc *retryCheck) policy() Policy {
+	return Policy{
+		SessionTimeout: rc.sessionTimeout,
+		Backoff:        rc.backoff,
+		MaxRetries:     rc.maxRetries,
+		Budget:         rc.budget,
+		Observers:      rc.observers,
+		Classifier:     AbortOn(rc.aborts...),
+		Breaker:        rc.breaker,
+	}
+}
+
+type Condition func(session *gexec.Session) bool
 
-		session := rc.sessionProvider().Wait(rc.sessionTimeout)
+// Abort classifies a failed session as fatal, returning the reason to fail with
+type Abort func(session *gexec.Session) (reason string, abort bool)
 
-		if c(session) {
-			return true
-		}
+// AbortWhen aborts with reason whenever c matches a failed session
+func AbortWhen(c Condition, reason string) Abort {
+	return func(session *gexec.Session) (string, bool) {
+		return reason, c(session)
 	}
-
-	return false
 }
 
-func (rc *retryCheck) checkAny(conditions ...Condition) bool {
-	for retry := 0; retry <= rc.maxRetries; retry++ {
-		time.Sleep(rc.backoff(uint(retry)))
+// AbortOn builds a Classifier for sessions out of aborts
+func AbortOn(aborts ...Abort) Classifier {
+	if len(aborts) == 0 {
+		return nil
+	}
+
+	return func(result interface{}, err error) (string, bool) {
+		session, ok := result.(*gexec.Session)
+		if !ok {
+			return "", false
+		}
 
-		session := rc.sessionProvider().Wait(rc.sessionTimeout)
+		for _, abort := range aborts {
+			if reason, fatal := abort(session); fatal {
+				return reason, true
+			}
+		}
+		return "", false
+	}
+}
 
+// Any is satisfied when at least one of the conditions is
+func Any(conditions ...Condition) Condition {
+	return func(session *gexec.Session) bool {
 		for _, condition := range conditions {
 			if condition(session) {
 				return true
 			}
 		}
+		return false
 	}
-	return false
 }
 
-func (rc *retryCheck) checkAll(conditions ...Condition) bool {
-RetryLoop:
-	for retry := 0; retry <= rc.maxRetries; retry++ {
-		time.Sleep(rc.backoff(uint(retry)))
-
-		session := rc.sessionProvider().Wait(rc.sessionTimeout)
-
+// All is satisfied when every one of the conditions is
+func All(conditions ...Condition) Condition {
+	return func(session *gexec.Session) bool {
 		for _, condition := range conditions {
 			if !condition(session) {
-				continue RetryLoop
+				return false
 			}
 		}
 		return true
 	}
-	return false
 }
 
-type Condition func(session *gexec.Session) bool
-
 func Succeeds(session *gexec.Session) bool {
 	return session.ExitCode() == 0
 }
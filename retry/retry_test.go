@@ -227,6 +227,47 @@ var _ = Describe("retry", func() {
 		})
 	})
 
+	Describe("WithAbort", func() {
+		var message string
+
+		BeforeEach(func() {
+			attempts = 0
+			message = ""
+		})
+
+		It("stops retrying as soon as an abort matches and fails with its reason", func() {
+			retry.Session(failureFn).WithMaxRetries(5).AndBackoff(retry.None(time.Millisecond)).AndAbort(
+				retry.AbortWhen(retry.MatchesErrorOutput(regexp.MustCompile("No such file")), "file is missing"),
+			).AndFailHandler(func(msg string, i ...int) {
+				message = msg
+			}).Until(retry.Succeeds, "generic failure")
+
+			Expect(attempts).To(Equal(1))
+			Expect(message).To(HavePrefix("file is missing"))
+		})
+
+		It("keeps retrying when no abort matches", func() {
+			retry.Session(failureFn).WithMaxRetries(3).AndBackoff(retry.None(time.Millisecond)).AndAbort(
+				retry.AbortWhen(retry.MatchesErrorOutput(regexp.MustCompile("permission denied")), "not allowed"),
+			).AndFailHandler(func(msg string, i ...int) {
+				message = msg
+			}).Until(retry.Succeeds, "generic failure")
+
+			Expect(attempts).To(Equal(4))
+			Expect(message).To(HavePrefix("generic failure"))
+		})
+
+		It("does not abort a session that satisfies the condition", func() {
+			failed = false
+			retry.Session(successFn).WithMaxRetries(3).AndBackoff(retry.None(time.Millisecond)).AndAbort(
+				retry.AbortWhen(retry.MatchesOutput(regexp.MustCompile("hello")), "said hello"),
+			).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+			Expect(attempts).To(Equal(1))
+			Expect(failed).To(BeFalse())
+		})
+	})
+
 	Context("Backoff", func() {
 		var baseline = time.Second
 
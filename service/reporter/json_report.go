@@ -0,0 +1,193 @@
+package reporter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/types"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// specRecord is a snapshot of a spec's steps, taken when the spec completes
+// since the steps are cleared before the next spec runs
+type specRecord struct {
+	title     string
+	fullTitle string
+	state     types.SpecState
+	runTime   time.Duration
+	failure   string
+	steps     []Step
+	plans     []string
+}
+
+type jsonReport struct {
+	Node     int        `json:"node"`
+	Passed   bool       `json:"passed"`
+	Setup    jsonPhase  `json:"setup"`
+	Specs    []jsonSpec `json:"specs"`
+	Teardown jsonPhase  `json:"teardown"`
+}
+
+type jsonPhase struct {
+	FailReason      string              `json:"fail_reason,omitempty"`
+	Failure         *failreason.Failure `json:"failure,omitempty"`
+	Troubleshooting *Remediation        `json:"troubleshooting,omitempty"`
+	Steps           []jsonStep          `json:"steps"`
+}
+
+type jsonSpec struct {
+	Title           string              `json:"title"`
+	Result          string              `json:"result"`
+	DurationSeconds float64             `json:"duration_seconds"`
+	FailReason      string              `json:"fail_reason,omitempty"`
+	Failure         *failreason.Failure `json:"failure,omitempty"`
+	Troubleshooting *Remediation        `json:"troubleshooting,omitempty"`
+	Steps           []jsonStep          `json:"steps"`
+}
+
+type jsonStep struct {
+	Description     string              `json:"description"`
+	Result          string              `json:"result"`
+	Started         *time.Time          `json:"started,omitempty"`
+	DurationSeconds float64             `json:"duration_seconds"`
+	Attempts        int                 `json:"attempts"`
+	FailReason      string              `json:"fail_reason,omitempty"`
+	Failure         *failreason.Failure `json:"failure,omitempty"`
+	Troubleshooting *Remediation        `json:"troubleshooting,omitempty"`
+	Metrics         map[string]float64  `json:"metrics,omitempty"`
+	Warnings        []string            `json:"warnings,omitempty"`
+}
+
+func (report *SmokeTestReport) recordSpec(summary *types.SpecSummary) {
+	record := specRecord{
+		title:     report.getTitleFromComponents(summary),
+		fullTitle: strings.Join(summary.ComponentTexts, " "),
+		state:     summary.State,
+		runTime:   summary.RunTime,
+		plans:     report.specPlans(summary),
+	}
+	if summary.Failed() {
+		record.failure = summary.Failure.Message
+	}
+	for _, step := range report.specSteps {
+		record.steps = append(record.steps, *step)
+	}
+
+	report.specs = append(report.specs, record)
+}
+
+// writeJSON writes the report for this node
+func (report *SmokeTestReport) writeJSON(summary *types.SuiteSummary) error {
+	out := jsonReport{
+		Node:     ginkgo.GinkgoParallelNode(),
+		Passed:   summary.SuiteSucceeded,
+		Setup:    newJSONPhase(report.beforeSuitesteps, report.setupFailure),
+		Specs:    []jsonSpec{},
+		Teardown: newJSONPhase(report.afterSuiteSteps, report.teardownFailure),
+	}
+
+	for _, spec := range report.specs {
+		out.Specs = append(out.Specs, jsonSpec{
+			Title:           spec.title,
+			Result:          specResult(spec.state),
+			DurationSeconds: spec.runTime.Seconds(),
+			FailReason:      failReason(spec.failure),
+			Failure:         parseFailure(spec.failure),
+			Troubleshooting: remediationFor(parseFailure(spec.failure)),
+			Steps:           jsonSteps(spec.stepPointers(), spec.failure),
+		})
+	}
+
+	encoded, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeNodeFile(report.JSONReportPath, encoded)
+}
+
+func newJSONPhase(steps []*Step, failure string) jsonPhase {
+	return jsonPhase{
+		FailReason:      failReason(failure),
+		Failure:         parseFailure(failure),
+		Troubleshooting: remediationFor(parseFailure(failure)),
+		Steps:           jsonSteps(steps, failure),
+	}
+}
+
+func (spec specRecord) stepPointers() []*Step {
+	steps := make([]*Step, len(spec.steps))
+	for i := range spec.steps {
+		steps[i] = &spec.steps[i]
+	}
+	return steps
+}
+
+// writeNodeFile writes contents to path, or for nodes other than the first to
+// path with the node number added, since each parallel node runs its own specs
+func writeNodeFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(nodePath(path), contents, 0644)
+}
+
+// jsonSteps converts steps, attributing failure to the step that failed, since
+// a failure stops the steps that follow it from running
+func jsonSteps(steps []*Step, failure string) []jsonStep {
+	converted := []jsonStep{}
+	for _, step := range steps {
+		s := jsonStep{
+			Description:     step.Description,
+			Result:          step.Result,
+			DurationSeconds: step.Duration.Seconds(),
+			Attempts:        len(step.Attempts),
+			Metrics:         step.Metrics,
+			Warnings:        step.Warnings,
+		}
+		if !step.Started.IsZero() {
+			started := step.Started
+			s.Started = &started
+		}
+		if step.Result == "FAILED" {
+			s.FailReason = failReason(failure)
+			s.Failure = parseFailure(failure)
+			s.Troubleshooting = remediationFor(s.Failure)
+		}
+		converted = append(converted, s)
+	}
+	return converted
+}
+
+func specResult(state types.SpecState) string {
+	switch state {
+	case types.SpecStatePassed:
+		return "PASSED"
+	case types.SpecStateSkipped:
+		return "SKIPPED"
+	case types.SpecStatePending:
+		return "PENDING"
+	case types.SpecStatePanicked:
+		return "PANICKED"
+	case types.SpecStateTimedOut:
+		return "TIMED OUT"
+	default:
+		return "FAILED"
+	}
+}
+
+func nodePath(path string) string {
+	node := ginkgo.GinkgoParallelNode()
+	if node == 1 {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + strconv.Itoa(node) + ext
+}
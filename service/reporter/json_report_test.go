@@ -0,0 +1,109 @@
+package reporter_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo/types"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON report", func() {
+	var (
+		dir    string
+		report *reporter.SmokeTestReport
+	)
+
+	readReport := func() map[string]interface{} {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "report.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(contents, &decoded)).To(Succeed())
+		return decoded
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "reporter")
+		Expect(err).NotTo(HaveOccurred())
+
+		report = &reporter.SmokeTestReport{JSONReportPath: filepath.Join(dir, "report.json")}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("records every spec's steps with the FailReason on the failed step", func() {
+		setup := reporter.NewStep("Setup test suite", func() {})
+		setup.Perform()
+		report.RegisterBeforeSuiteSteps([]*reporter.Step{setup})
+		report.BeforeSuiteDidRun(&types.SetupSummary{State: types.SpecStatePassed})
+
+		passed := reporter.NewStep("Write a key", func() {}).WithMetrics(func() map[string]float64 {
+			return map[string]float64{"p99_ms": 1.5}
+		}).WithWarning(func() string {
+			return "certificate chain was not verified"
+		})
+		passed.Perform()
+		failed := reporter.NewStep("Read the key", nil)
+		failed.Result = "FAILED"
+		report.RegisterSpecSteps([]*reporter.Step{passed, failed, reporter.NewStep("Delete the key", func() {})})
+		report.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"Redis", "life-cycle"},
+			State:          types.SpecStateFailed,
+			Failure: types.SpecFailure{
+				Message: failreason.New(failreason.AppReadFailed, "Failed to get mykey").With("url", `https://app/"mykey"`).Because("exceeded 10 retries"),
+			},
+		})
+
+		report.ClearSpecSteps()
+		report.SpecDidComplete(&types.SpecSummary{ComponentTexts: []string{"Redis", "isolation"}, State: types.SpecStateSkipped})
+
+		report.SpecSuiteDidEnd(&types.SuiteSummary{NumberOfFailedSpecs: 1})
+
+		decoded := readReport()
+		Expect(decoded["passed"]).To(BeFalse())
+		Expect(decoded["setup"]).To(HaveKeyWithValue("steps", ConsistOf(
+			SatisfyAll(HaveKeyWithValue("description", "Setup test suite"), HaveKeyWithValue("result", "PASSED"), HaveKey("started")),
+		)))
+
+		specs := decoded["specs"].([]interface{})
+		Expect(specs).To(HaveLen(2))
+
+		lifeCycle := specs[0].(map[string]interface{})
+		Expect(lifeCycle).To(HaveKeyWithValue("title", "life-cycle"))
+		Expect(lifeCycle).To(HaveKeyWithValue("result", "FAILED"))
+		Expect(lifeCycle).To(HaveKeyWithValue("fail_reason", "Failed to get mykey"))
+		Expect(lifeCycle).To(HaveKeyWithValue("failure", SatisfyAll(
+			HaveKeyWithValue("code", "app-read-failed"),
+			HaveKeyWithValue("resources", ConsistOf(map[string]interface{}{"kind": "url", "name": `https://app/"mykey"`})),
+			HaveKeyWithValue("docs_url", failreason.DocsURL),
+		)))
+		Expect(lifeCycle).To(HaveKeyWithValue("troubleshooting", HaveKey("likely_causes")))
+
+		steps := lifeCycle["steps"].([]interface{})
+		Expect(steps).To(HaveLen(3))
+		Expect(steps[0]).To(HaveKeyWithValue("metrics", HaveKeyWithValue("p99_ms", 1.5)))
+		Expect(steps[0]).To(HaveKeyWithValue("warnings", ConsistOf("certificate chain was not verified")))
+		Expect(steps[0]).NotTo(HaveKey("fail_reason"))
+		Expect(steps[1]).NotTo(HaveKey("warnings"))
+		Expect(steps[1]).To(HaveKeyWithValue("fail_reason", "Failed to get mykey"))
+		Expect(steps[1]).To(HaveKeyWithValue("failure", HaveKeyWithValue("code", "app-read-failed")))
+		Expect(steps[1]).To(HaveKeyWithValue("troubleshooting", HaveKeyWithValue("next_steps", ContainElement(
+			reporter.Remediations[failreason.AppReadFailed].NextSteps[0],
+		))))
+		Expect(steps[2]).To(HaveKeyWithValue("result", "DIDN'T RUN"))
+		Expect(steps[2]).NotTo(HaveKey("started"))
+
+		Expect(specs[1]).To(HaveKeyWithValue("result", "SKIPPED"))
+		Expect(specs[1]).To(HaveKeyWithValue("steps", BeEmpty()))
+	})
+})
@@ -0,0 +1,124 @@
+package reporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes the report for this node as JUnit XML
+func (report *SmokeTestReport) writeJUnit() error {
+	var out junitTestSuites
+
+	if len(report.beforeSuitesteps) > 0 {
+		out.Suites = append(out.Suites, junitSuite("Suite setup", report.beforeSuitesteps, report.setupFailure))
+	}
+	for _, spec := range report.specs {
+		out.Suites = append(out.Suites, junitSuite(spec.fullTitle, spec.stepPointers(), spec.failure))
+	}
+	if len(report.afterSuiteSteps) > 0 {
+		out.Suites = append(out.Suites, junitSuite("Suite teardown", report.afterSuiteSteps, report.teardownFailure))
+	}
+
+	encoded, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeNodeFile(report.JUnitReportPath, append([]byte(xml.Header), encoded...))
+}
+
+// junitSuite maps steps to testcases: FAILED steps carry the FailReason as
+// their failure message, and steps that were skipped or never ran are skipped
+func junitSuite(name string, steps []*Step, failure string) junitTestSuite {
+	suite := junitTestSuite{Name: name, Cases: []junitTestCase{}}
+
+	var total time.Duration
+	for _, step := range steps {
+		testCase := junitTestCase{
+			Name:      step.Description,
+			Classname: name,
+			Time:      seconds(step.Duration),
+		}
+
+		switch step.Result {
+		case "PASSED":
+		case "FAILED":
+			testCase.Failure = newJUnitFailure(failure, "Step failed")
+			suite.Failures++
+		default:
+			testCase.Skipped = &junitSkipped{Message: step.Result}
+			suite.Skipped++
+		}
+
+		total += step.Duration
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	// a failure outside any step still needs a testcase for CI to show it
+	if failure != "" && suite.Failures == 0 {
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      name,
+			Classname: name,
+			Time:      seconds(0),
+			Failure:   newJUnitFailure(failure, ""),
+		})
+		suite.Failures++
+	}
+
+	suite.Tests = len(suite.Cases)
+	suite.Time = seconds(total)
+	return suite
+}
+
+// newJUnitFailure uses the failure's reason as the message, or fallback if it
+// has none, its code as the type, and follows the failure message with the
+// catalog's remediation for the code
+func newJUnitFailure(failure, fallback string) *junitFailure {
+	converted := &junitFailure{Message: fallback, Type: "Failure", Contents: failure}
+	if f := parseFailure(failure); f != nil {
+		converted.Message = f.Reason
+		if f.Code != "" {
+			converted.Type = string(f.Code)
+		}
+		if remediation := remediationFor(f); remediation != nil {
+			converted.Contents += "\n\n" + remediation.String()
+		}
+	}
+	return converted
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,111 @@
+package reporter_test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo/types"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testSuites struct {
+	Suites []struct {
+		Name     string `xml:"name,attr"`
+		Tests    int    `xml:"tests,attr"`
+		Failures int    `xml:"failures,attr"`
+		Skipped  int    `xml:"skipped,attr"`
+		Cases    []struct {
+			Name    string `xml:"name,attr"`
+			Failure *struct {
+				Message  string `xml:"message,attr"`
+				Type     string `xml:"type,attr"`
+				Contents string `xml:",chardata"`
+			} `xml:"failure"`
+			Skipped *struct {
+				Message string `xml:"message,attr"`
+			} `xml:"skipped"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+var _ = Describe("JUnit report", func() {
+	var (
+		dir    string
+		report *reporter.SmokeTestReport
+	)
+
+	readReport := func() testSuites {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "junit.xml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var decoded testSuites
+		Expect(xml.Unmarshal(contents, &decoded)).To(Succeed())
+		return decoded
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "reporter")
+		Expect(err).NotTo(HaveOccurred())
+
+		report = &reporter.SmokeTestReport{JUnitReportPath: filepath.Join(dir, "junit.xml")}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("makes every spec a testsuite and every step a testcase", func() {
+		passed := reporter.NewStep("Create service key", func() {})
+		passed.Perform()
+		failed := reporter.NewStep("Read the key", nil)
+		failed.Result = "FAILED"
+		skipped := reporter.NewStep("Create a 'cache-small' plan instance", nil)
+		skipped.Result = "SKIPPED"
+
+		report.RegisterSpecSteps([]*reporter.Step{passed, failed, skipped, reporter.NewStep("Delete the app", nil)})
+		report.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"Redis", "for CACHE-SMALL plans:", "life-cycle"},
+			State:          types.SpecStateFailed,
+			Failure:        types.SpecFailure{Message: failreason.New(failreason.AppReadFailed, `Failed to get "mykey"`).Because("exceeded 10 retries")},
+		})
+		report.SpecSuiteDidEnd(&types.SuiteSummary{NumberOfFailedSpecs: 1})
+
+		suites := readReport().Suites
+		Expect(suites).To(HaveLen(1))
+		Expect(suites[0].Name).To(Equal("Redis for CACHE-SMALL plans: life-cycle"))
+		Expect(suites[0].Tests).To(Equal(4))
+		Expect(suites[0].Failures).To(Equal(1))
+		Expect(suites[0].Skipped).To(Equal(2))
+
+		cases := suites[0].Cases
+		Expect(cases[0].Failure).To(BeNil())
+		Expect(cases[0].Skipped).To(BeNil())
+		Expect(cases[1].Failure.Message).To(Equal(`Failed to get "mykey"`))
+		Expect(cases[1].Failure.Type).To(Equal("app-read-failed"))
+		Expect(cases[1].Failure.Contents).To(ContainSubstring("Next steps:\n  - " + reporter.Remediations[failreason.AppReadFailed].NextSteps[0]))
+		Expect(cases[1].Failure.Contents).To(ContainSubstring("exceeded 10 retries"))
+		Expect(cases[2].Skipped.Message).To(Equal("SKIPPED"))
+		Expect(cases[3].Skipped.Message).To(Equal("DIDN'T RUN"))
+	})
+
+	It("adds a testcase for a failure outside any step", func() {
+		report.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"Redis", "life-cycle"},
+			State:          types.SpecStateFailed,
+			Failure:        types.SpecFailure{Message: `{"FailReason": "Invalid data_types configuration for plan 'cache-small'"}`},
+		})
+		report.SpecSuiteDidEnd(&types.SuiteSummary{NumberOfFailedSpecs: 1})
+
+		cases := readReport().Suites[0].Cases
+		Expect(cases).To(HaveLen(1))
+		Expect(cases[0].Failure.Message).To(Equal("Invalid data_types configuration for plan 'cache-small'"))
+		Expect(cases[0].Failure.Type).To(Equal("Failure"))
+	})
+})
@@ -0,0 +1,256 @@
+package reporter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/types"
+)
+
+const metricPrefix = "redis_smoke_test_"
+
+// MetricsExporter writes a run's results as Prometheus metrics, to a file for
+// node_exporter's textfile collector, to a Pushgateway, or both
+type MetricsExporter struct {
+	// TextfilePath, if set, is where the metrics are written. It should end in
+	// .prom and be in node_exporter's --collector.textfile.directory.
+	TextfilePath string
+	// PushgatewayURL, if set, is the Pushgateway the metrics are pushed to,
+	// replacing any that an earlier run pushed
+	PushgatewayURL string
+	// Job is the Pushgateway job the metrics are grouped under
+	Job string
+	// Client pushes the metrics; http.DefaultClient is used when it is nil
+	Client *http.Client
+}
+
+// PlanContext records that the specs in a container with text exercise
+// plans, so that their outcome counts towards each plan's in the metrics, and
+// returns text
+func (report *SmokeTestReport) PlanContext(text string, plans ...string) string {
+	if report.planContexts == nil {
+		report.planContexts = map[string][]string{}
+	}
+	for _, plan := range plans {
+		if !containsString(report.planContexts[text], plan) {
+			report.planContexts[text] = append(report.planContexts[text], plan)
+		}
+	}
+	return text
+}
+
+func (report *SmokeTestReport) specPlans(summary *types.SpecSummary) []string {
+	var plans []string
+	for _, text := range summary.ComponentTexts {
+		plans = append(plans, report.planContexts[text]...)
+	}
+	return plans
+}
+
+// exportMetrics writes and pushes the metrics for this node
+func (report *SmokeTestReport) exportMetrics(summary *types.SuiteSummary) error {
+	exporter := report.Metrics
+	metrics := report.prometheusMetrics(summary, time.Now())
+
+	var contents bytes.Buffer
+	metrics.writeTo(&contents)
+
+	if exporter.TextfilePath != "" {
+		if err := writeTextfile(nodePath(exporter.TextfilePath), contents.Bytes()); err != nil {
+			return err
+		}
+	}
+	if exporter.PushgatewayURL != "" {
+		if err := exporter.push(contents.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (report *SmokeTestReport) prometheusMetrics(summary *types.SuiteSummary, now time.Time) *promMetrics {
+	metrics := new(promMetrics)
+
+	addSteps := func(phase, spec string, steps []*Step) {
+		for i, step := range steps {
+			// the index keeps series apart when two steps share a description
+			labels := []string{"phase", phase, "spec", spec, "index", strconv.Itoa(i + 1), "step", firstLine(step.Description)}
+			metrics.add("step_duration_seconds", "How long the step took", step.Duration.Seconds(), labels...)
+			metrics.add("step_attempts", "Attempts made by the step's retried operations", float64(len(step.Attempts)), labels...)
+			metrics.add("step_result", "The step's result, set to 1 for the result it had", 1, append(labels, "result", step.Result)...)
+		}
+	}
+
+	addSteps("setup", "Suite setup", report.beforeSuitesteps)
+	planPassed := map[string]bool{}
+	var plans []string
+	for _, spec := range report.specs {
+		addSteps("spec", spec.fullTitle, spec.stepPointers())
+		if spec.state == types.SpecStateSkipped || spec.state == types.SpecStatePending {
+			continue
+		}
+
+		passed := spec.state == types.SpecStatePassed
+		for _, plan := range spec.plans {
+			if _, seen := planPassed[plan]; !seen {
+				plans = append(plans, plan)
+				planPassed[plan] = true
+			}
+			planPassed[plan] = planPassed[plan] && passed
+		}
+	}
+	addSteps("teardown", "Suite teardown", report.afterSuiteSteps)
+
+	sort.Strings(plans)
+	for _, plan := range plans {
+		metrics.add("plan_success", "Whether every spec that exercised the plan passed", boolValue(planPassed[plan]), "plan", plan)
+	}
+
+	metrics.add("success", "Whether the smoke tests passed", boolValue(summary.SuiteSucceeded))
+	metrics.add("last_run_timestamp_seconds", "When the smoke tests finished", float64(now.Unix()))
+	return metrics
+}
+
+// push replaces the metrics in the job's group for this node, so that stale
+// steps from an earlier run do not linger
+func (exporter MetricsExporter) push(contents []byte) error {
+	job := exporter.Job
+	if job == "" {
+		job = "cf-redis-smoke-tests"
+	}
+
+	endpoint := fmt.Sprintf("%s/metrics/job/%s/node/%d",
+		strings.TrimSuffix(exporter.PushgatewayURL, "/"), url.PathEscape(job), ginkgo.GinkgoParallelNode())
+	request, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := exporter.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("pushgateway responded %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// writeTextfile writes to a temporary file and renames it into place, so that
+// the textfile collector never reads a partly written file
+func writeTextfile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// promMetrics builds metrics in the Prometheus text exposition format, keeping
+// families and their samples in the order they were added
+type promMetrics struct {
+	families []*promFamily
+}
+
+type promFamily struct {
+	name    string
+	help    string
+	samples []string
+}
+
+// add records a gauge sample, with labels given as name, value pairs
+func (m *promMetrics) add(name, help string, value float64, labels ...string) {
+	name = metricPrefix + name
+
+	var family *promFamily
+	for _, f := range m.families {
+		if f.name == name {
+			family = f
+		}
+	}
+	if family == nil {
+		family = &promFamily{name: name, help: help}
+		m.families = append(m.families, family)
+	}
+
+	sample := name
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabelValue(labels[i+1])))
+		}
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	family.samples = append(family.samples, sample+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (m *promMetrics) writeTo(out *bytes.Buffer) {
+	for _, family := range m.families {
+		fmt.Fprintf(out, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(out, "# TYPE %s gauge\n", family.name)
+		for _, sample := range family.samples {
+			fmt.Fprintln(out, sample)
+		}
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// firstLine drops the hints some step descriptions carry on later lines
+func firstLine(description string) string {
+	return strings.TrimSpace(strings.SplitN(description, "\n", 2)[0])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
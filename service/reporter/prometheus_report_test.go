@@ -0,0 +1,121 @@
+package reporter_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo/types"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prometheus metrics", func() {
+	var (
+		dir    string
+		report *reporter.SmokeTestReport
+	)
+
+	runSuite := func() {
+		report.RegisterSpecSteps([]*reporter.Step{
+			{Description: "Create a 'cache-small' plan instance of Redis\n    Please refer to the docs", Result: "PASSED", Attempts: make([]retry.Attempt, 3)},
+			{Description: `Read "mykey"`, Result: "FAILED"},
+			{Description: `Read "mykey"`, Result: "DIDN'T RUN"},
+		})
+		report.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"Redis", report.PlanContext("for CACHE-SMALL plans:", "cache-small"), "life-cycle"},
+			State:          types.SpecStateFailed,
+		})
+
+		report.ClearSpecSteps()
+		report.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"Redis", report.PlanContext("for CACHE-LARGE plans:", "cache-large"), "life-cycle"},
+			State:          types.SpecStatePassed,
+		})
+		report.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"Redis", "for CACHE-LARGE plans:", "isolation"},
+			State:          types.SpecStateSkipped,
+		})
+
+		report.SpecSuiteDidEnd(&types.SuiteSummary{SuiteSucceeded: false, NumberOfFailedSpecs: 1})
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "reporter")
+		Expect(err).NotTo(HaveOccurred())
+
+		report = new(reporter.SmokeTestReport)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("writes a textfile collector file with step and plan metrics", func() {
+		report.Metrics = reporter.MetricsExporter{TextfilePath: filepath.Join(dir, "metrics", "smoke-tests.prom")}
+
+		runSuite()
+
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "metrics", "smoke-tests.prom"))
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(string(contents), "\n")
+
+		spec := `phase="spec",spec="Redis for CACHE-SMALL plans: life-cycle"`
+		Expect(lines).To(ContainElement("# TYPE redis_smoke_test_step_duration_seconds gauge"))
+		Expect(lines).To(ContainElement(`redis_smoke_test_step_attempts{` + spec + `,index="1",step="Create a 'cache-small' plan instance of Redis"} 3`))
+		Expect(lines).To(ContainElement(`redis_smoke_test_step_result{` + spec + `,index="2",step="Read \"mykey\"",result="FAILED"} 1`))
+		Expect(lines).To(ContainElement(`redis_smoke_test_step_result{` + spec + `,index="3",step="Read \"mykey\"",result="DIDN'T RUN"} 1`))
+		Expect(lines).To(ContainElement(`redis_smoke_test_plan_success{plan="cache-small"} 0`))
+		Expect(lines).To(ContainElement(`redis_smoke_test_plan_success{plan="cache-large"} 1`))
+		Expect(lines).To(ContainElement(`redis_smoke_test_success 0`))
+		Expect(lines).To(ContainElement(HavePrefix("redis_smoke_test_last_run_timestamp_seconds ")))
+
+		leftovers, err := filepath.Glob(filepath.Join(dir, "metrics", "*.tmp*"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leftovers).To(BeEmpty())
+	})
+
+	It("pushes the metrics to a Pushgateway, replacing the node's group", func() {
+		var (
+			method, path, contentType string
+			body                      []byte
+		)
+		pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+			body, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer pushgateway.Close()
+
+		report.Metrics = reporter.MetricsExporter{PushgatewayURL: pushgateway.URL + "/", Job: "redis canary"}
+
+		runSuite()
+
+		Expect(method).To(Equal(http.MethodPut))
+		Expect(path).To(Equal("/metrics/job/redis canary/node/1"))
+		Expect(contentType).To(HavePrefix("text/plain; version=0.0.4"))
+		Expect(string(body)).To(ContainSubstring(`redis_smoke_test_plan_success{plan="cache-small"} 0`))
+	})
+
+	It("still writes the textfile when the Pushgateway rejects the metrics", func() {
+		pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid metric", http.StatusBadRequest)
+		}))
+		defer pushgateway.Close()
+
+		report.Metrics = reporter.MetricsExporter{
+			PushgatewayURL: pushgateway.URL,
+			TextfilePath:   filepath.Join(dir, "smoke-tests.prom"),
+		}
+
+		Expect(runSuite).NotTo(Panic())
+		Expect(filepath.Join(dir, "smoke-tests.prom")).To(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,264 @@
+package reporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+)
+
+// Remediation is what an operator should check when a kind of failure occurs
+type Remediation struct {
+	LikelyCauses []string `json:"likely_causes"`
+	NextSteps    []string `json:"next_steps"`
+}
+
+// Remediations catalogs the likely causes of each failure code and the steps
+// an operator should take next
+var Remediations = map[failreason.Code]Remediation{
+	failreason.QuotaReached: {
+		LikelyCauses: []string{
+			"The smoke test org's quota allows fewer service instances or less memory than the tests need",
+			"Instances left behind by an earlier run that was interrupted count against the quota",
+		},
+		NextSteps: []string{
+			"Run `cf quota` for the smoke test org's quota and raise its service instance and memory limits",
+			"Delete leftover smoke test orgs with `cf orgs` and `cf delete-org`",
+		},
+	},
+	failreason.QuotaCreateFailed: {
+		LikelyCauses: []string{
+			"The smoke test user is not an admin and cannot create quotas",
+		},
+		NextSteps: []string{
+			"Check that the configured user or client has the cloud_controller.admin scope",
+		},
+	},
+	failreason.SecurityGroupCreateFailed: {
+		LikelyCauses: []string{
+			"The smoke test user cannot manage security groups",
+			"A security group with the same name was left behind by an earlier run",
+		},
+		NextSteps: []string{
+			"Check that the configured user or client has the cloud_controller.admin scope",
+			"Delete leftover smoke test security groups with `cf security-groups` and `cf delete-security-group`",
+		},
+	},
+	failreason.SecurityGroupBindFailed: {
+		LikelyCauses: []string{
+			"The smoke test space was deleted or renamed while the tests ran",
+			"The Cloud Controller rejected the binding because the security group was not created",
+		},
+		NextSteps: []string{
+			"Run `cf security-group` for the named group and check which spaces it is bound to",
+			"Check the Cloud Controller logs for the binding request",
+		},
+	},
+	failreason.AppPushFailed: {
+		LikelyCauses: []string{
+			"No buildpack or stack can stage the test app",
+			"The org quota does not leave enough memory for the test app",
+		},
+		NextSteps: []string{
+			"Run `cf logs` for the test app to see the staging output",
+			"Check that ruby_buildpack is installed and enabled with `cf buildpacks`",
+		},
+	},
+	failreason.AppStartFailed: {
+		LikelyCauses: []string{
+			"The test app crashed on start because it could not read its service binding",
+			"Diego cells are out of capacity",
+		},
+		NextSteps: []string{
+			"Run `cf logs --recent` for the test app",
+			"Run `cf events` for the test app for crash reasons",
+		},
+	},
+	failreason.AppNotResponding: {
+		LikelyCauses: []string{
+			"The app's route is not registered with the gorouter yet",
+			"A security group does not allow the app to reach the Redis instance, so it fails health checks",
+			"The configured apps domain does not resolve from where the tests run",
+		},
+		NextSteps: []string{
+			"Run `cf app` for the test app and curl its route",
+			"Check that the app's space has a security group allowing the instance's host and ports",
+			"Check that the apps domain in the config resolves and routes to the gorouter",
+		},
+	},
+	failreason.AppWriteFailed: {
+		LikelyCauses: []string{
+			"The test app cannot reach the Redis instance",
+			"The instance has reached its maxmemory with the noeviction policy",
+		},
+		NextSteps: []string{
+			"Run `cf logs --recent` for the test app for Redis errors",
+			"Check the instance's memory use with INFO memory",
+		},
+	},
+	failreason.AppReadFailed: {
+		LikelyCauses: []string{
+			"The instance lost the key, for example because it restarted without persistence",
+			"The test app cannot reach the Redis instance",
+		},
+		NextSteps: []string{
+			"Run `cf logs --recent` for the test app for Redis errors",
+			"Check whether the instance's VM or process restarted during the run",
+		},
+	},
+	failreason.ServiceCreateFailed: {
+		LikelyCauses: []string{
+			"The service broker is unavailable or timed out",
+			"The on-demand broker failed to deploy the instance with BOSH",
+			"The plan is not enabled for the smoke test org",
+		},
+		NextSteps: []string{
+			"Run `cf service` for the instance to see the broker's last operation message",
+			"Check the broker logs and, for on-demand plans, `bosh tasks --recent` for the failed deployment",
+			"Run `cf marketplace` as the smoke test user to check the plan is visible",
+		},
+	},
+	failreason.ServiceOfferingNotFound: {
+		LikelyCauses: []string{
+			"The service broker is not registered, or registered under a different offering name",
+		},
+		NextSteps: []string{
+			"Run `cf service-brokers` and `cf service-access` and compare with service_name in the config",
+		},
+	},
+	failreason.ServicePlanNotFound: {
+		LikelyCauses: []string{
+			"The config names a plan the broker does not offer",
+			"The plan was removed from the broker's catalog",
+		},
+		NextSteps: []string{
+			"Run `cf service-access` and compare the plans with plan_names in the config",
+		},
+	},
+	failreason.ServiceDeleteFailed: {
+		LikelyCauses: []string{
+			"The broker failed to deprovision the instance",
+		},
+		NextSteps: []string{
+			"Run `cf service` for the instance to see the broker's last operation message",
+			"Purge the instance with `cf purge-service-instance` once the broker problem is fixed",
+		},
+	},
+	failreason.PlanChangeRejected: {
+		LikelyCauses: []string{
+			"The broker does not allow changing between the configured plans",
+		},
+		NextSteps: []string{
+			"Remove the pair from plan_upgrades, or enable plan updates for the offering",
+		},
+	},
+	failreason.CloudControllerUnavailable: {
+		LikelyCauses: []string{
+			"The Cloud Controller or UAA is down or overloaded",
+		},
+		NextSteps: []string{
+			"Run `cf curl /v3/info` and check the Cloud Controller and UAA VMs are healthy",
+		},
+	},
+	failreason.InvalidCredentials: {
+		LikelyCauses: []string{
+			"The configured admin user or client secret has been rotated",
+		},
+		NextSteps: []string{
+			"Update the credentials in the config and check them with `cf auth`",
+		},
+	},
+	failreason.RedisUnreachable: {
+		LikelyCauses: []string{
+			"The instance's VM or Redis process is down",
+			"A firewall or security group blocks the instance's ports from where the tests run",
+		},
+		NextSteps: []string{
+			"Check the instance's VM with `bosh instances` and its Redis logs",
+			"Connect with redis-cli to the address in the failure from the same network",
+		},
+	},
+	failreason.TLSMismatch: {
+		LikelyCauses: []string{
+			"The instance's tls_versions property differs from what the service key advertises",
+			"The instance has not been redeployed since TLS versions were changed on the tile",
+		},
+		NextSteps: []string{
+			"Compare the TLS versions in the failure with the tile's TLS settings",
+			"Upgrade the instance with `cf update-service --upgrade` or the broker's upgrade-all-service-instances errand",
+		},
+	},
+	failreason.TLSProbeFailed: {
+		LikelyCauses: []string{
+			"The instance's certificate is not signed by the CA in the service key",
+			"The certificate has expired or does not name the instance's host",
+		},
+		NextSteps: []string{
+			"Check the certificate with `openssl s_client -connect` to the TLS address in the failure",
+			"Rotate the instance's certificates through CredHub and redeploy",
+		},
+	},
+	failreason.AuthMisconfigured: {
+		LikelyCauses: []string{
+			"The instance has requirepass disabled",
+		},
+		NextSteps: []string{
+			"Check the instance's Redis config for requirepass and redeploy it",
+		},
+	},
+	failreason.IsolationBreached: {
+		LikelyCauses: []string{
+			"Two instances are sharing a Redis process or database",
+			"A key from an earlier run was not deleted",
+		},
+		NextSteps: []string{
+			"Compare the hosts and ports of both instances' service keys",
+		},
+	},
+	failreason.DataLost: {
+		LikelyCauses: []string{
+			"The plan's persistence is disabled or does not survive the update",
+		},
+		NextSteps: []string{
+			"Check the plan's persistence settings against the configured min_recovered_ratio",
+		},
+	},
+	failreason.MemoryConfigMismatch: {
+		LikelyCauses: []string{
+			"The plan's configuration changed on the tile but the instance was not upgraded",
+			"The config's expected maxmemory or version is out of date",
+		},
+		NextSteps: []string{
+			"Compare the plan's settings on the tile with the memory section of the config",
+		},
+	},
+}
+
+// remediationFor looks the failure's code up in the catalog
+func remediationFor(f *failreason.Failure) *Remediation {
+	if f == nil {
+		return nil
+	}
+	if remediation, ok := Remediations[f.Code]; ok {
+		return &remediation
+	}
+	return nil
+}
+
+// String lists the likely causes and next steps
+func (r Remediation) String() string {
+	var out strings.Builder
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Likely causes", r.LikelyCauses},
+		{"Next steps", r.NextSteps},
+	} {
+		fmt.Fprintf(&out, "%s:\n", section.title)
+		for _, item := range section.items {
+			fmt.Fprintf(&out, "  - %s\n", item)
+		}
+	}
+	return out.String()
+}
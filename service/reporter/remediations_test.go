@@ -0,0 +1,41 @@
+package reporter_test
+
+import (
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Remediations", func() {
+	It("covers the failures operators most often hit", func() {
+		for _, code := range []failreason.Code{
+			failreason.QuotaReached,
+			failreason.SecurityGroupBindFailed,
+			failreason.AppNotResponding,
+			failreason.TLSMismatch,
+			failreason.ServiceCreateFailed,
+		} {
+			Expect(reporter.Remediations).To(HaveKey(code))
+		}
+	})
+
+	It("gives every code likely causes and next steps", func() {
+		for code, remediation := range reporter.Remediations {
+			Expect(remediation.LikelyCauses).NotTo(BeEmpty(), string(code))
+			Expect(remediation.NextSteps).NotTo(BeEmpty(), string(code))
+		}
+	})
+
+	It("lists the causes and steps", func() {
+		remediation := reporter.Remediation{
+			LikelyCauses: []string{"The broker is down"},
+			NextSteps:    []string{"Check the broker logs", "Retry"},
+		}
+
+		Expect(remediation.String()).To(Equal(
+			"Likely causes:\n  - The broker is down\nNext steps:\n  - Check the broker logs\n  - Retry\n",
+		))
+	})
+})
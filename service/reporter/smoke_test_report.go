@@ -2,28 +2,129 @@ package reporter
 
 import (
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/config"
 	"github.com/onsi/ginkgo/types"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
 )
 
 type Step struct {
 	Description string
 	Result      string
 	Task        func()
-	Duration 	time.Duration
+	Started     time.Time
+	Duration    time.Duration
+	Attempts    []retry.Attempt
+	Metrics     map[string]float64
+	Warnings    []string
+
+	measure  func() map[string]float64
+	warn     func() string
+	attempts *stepAttempts
 }
 
+// WithMetrics has the step record the metrics returned by measure once its
+// task has run, so that measurements such as benchmark latencies appear in
+// the report
+func (step *Step) WithMetrics(measure func() map[string]float64) *Step {
+	step.measure = measure
+	return step
+}
+
+// WithWarning has the step record the warning returned by check once its task
+// has run, so that something the step could not check, such as an unverified
+// certificate chain, appears in the report. check returns "" for no warning.
+func (step *Step) WithWarning(check func() string) *Step {
+	step.warn = check
+	return step
+}
+
+// Perform runs the step's task, recording the attempts of the retried
+// operations it makes through its report's Observer, including when the task
+// fails
 func (step *Step) Perform() {
 	step.Result = "FAILED"
-	start := time.Now()
+
+	history := new(retry.History)
+	if step.attempts != nil {
+		defer step.attempts.record(history)()
+	}
+	step.Started = time.Now()
+
+	defer func() {
+		step.Duration = time.Since(step.Started)
+		step.Attempts = history.Attempts()
+		if step.measure != nil {
+			step.Metrics = step.measure()
+		}
+		if step.warn != nil {
+			if warning := step.warn(); warning != "" {
+				step.Warnings = append(step.Warnings, warning)
+			}
+		}
+	}()
+
 	step.Task()
 	step.Result = "PASSED"
-	step.Duration = time.Since(start)
+}
+
+// FailedAttempts returns the attempts that did not succeed, so that the
+// report can show why a step needed retrying
+func (step *Step) FailedAttempts() []retry.Attempt {
+	var failed []retry.Attempt
+	for _, attempt := range step.Attempts {
+		if !attempt.Succeeded {
+			failed = append(failed, attempt)
+		}
+	}
+	return failed
+}
+
+// MetricNames returns the names of the step's metrics in order
+func (step *Step) MetricNames() []string {
+	names := make([]string, 0, len(step.Metrics))
+	for name := range step.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stepAttempts passes the attempts it is notified of on to the history of
+// the step being performed
+type stepAttempts struct {
+	lock    sync.Mutex
+	history *retry.History
+}
+
+func (a *stepAttempts) BeforeAttempt(number int, slept time.Duration) {}
+
+func (a *stepAttempts) AfterAttempt(attempt retry.Attempt) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.history != nil {
+		a.history.AfterAttempt(attempt)
+	}
+}
+
+// record sends attempts to history until the returned function is called
+func (a *stepAttempts) record(history *retry.History) (stop func()) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.history = history
+
+	return func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		a.history = nil
+	}
 }
 
 func NewStep(description string, task func()) *Step {
@@ -40,23 +141,52 @@ type failure struct {
 }
 
 type SmokeTestReport struct {
+	// JSONReportPath, if set, is where a JSON copy of the report is written
+	// when the suite ends
+	JSONReportPath string
+	// JUnitReportPath, if set, is where the report is written as JUnit XML,
+	// with a testsuite per spec and a testcase per step
+	JUnitReportPath string
+	// Metrics, if it has a textfile path or Pushgateway URL, exports the
+	// report as Prometheus metrics when the suite ends
+	Metrics MetricsExporter
+
 	testCount        int
 	failures         []failure
 	beforeSuitesteps []*Step
 	afterSuiteSteps  []*Step
 	specSteps        []*Step
+
+	setupFailure    string
+	teardownFailure string
+	specs           []specRecord
+	planContexts    map[string][]string
+	attempts        stepAttempts
+}
+
+// Observer records the attempts of the retried operations it is attached to
+// against whichever of the report's registered steps is being performed
+func (report *SmokeTestReport) Observer() retry.Observer {
+	return &report.attempts
+}
+
+func (report *SmokeTestReport) observe(steps []*Step) []*Step {
+	for _, step := range steps {
+		step.attempts = &report.attempts
+	}
+	return steps
 }
 
 func (report *SmokeTestReport) RegisterBeforeSuiteSteps(steps []*Step) {
-	report.beforeSuitesteps = append(report.beforeSuitesteps, steps...)
+	report.beforeSuitesteps = append(report.beforeSuitesteps, report.observe(steps)...)
 }
 
 func (report *SmokeTestReport) RegisterAfterSuiteSteps(steps []*Step) {
-	report.afterSuiteSteps = append(report.afterSuiteSteps, steps...)
+	report.afterSuiteSteps = append(report.afterSuiteSteps, report.observe(steps)...)
 }
 
 func (report *SmokeTestReport) RegisterSpecSteps(steps []*Step) {
-	report.specSteps = append(report.specSteps, steps...)
+	report.specSteps = append(report.specSteps, report.observe(steps)...)
 }
 
 func (report *SmokeTestReport) ClearSpecSteps() {
@@ -85,6 +215,7 @@ func (report *SmokeTestReport) BeforeSuiteDidRun(summary *types.SetupSummary) {
 			title:   "Suite setup",
 			message: summary.Failure.Message,
 		})
+		report.setupFailure = summary.Failure.Message
 	}
 	report.printMessageTitle("Finished test suite setup")
 
@@ -111,6 +242,8 @@ func (report *SmokeTestReport) SpecDidComplete(summary *types.SpecSummary) {
 			message: summary.Failure.Message,
 		})
 	}
+	report.recordSpec(summary)
+
 	title := report.getTitleFromComponents(summary)
 	message := fmt.Sprintf("END %d. %s", report.testCount, title)
 	report.printMessageTitle(message)
@@ -118,12 +251,26 @@ func (report *SmokeTestReport) SpecDidComplete(summary *types.SpecSummary) {
 	fmt.Println("Smoke Test plan Results:")
 	count := len(report.specSteps)
 	for i, step := range report.specSteps {
-		fmt.Printf("[%d/%d] %s: %s Duration[%s] \n", i+1, count, step.Description, step.Result, step.Duration)
+		fmt.Printf("[%d/%d] %s: %s Duration[%s] Attempts[%d]\n", i+1, count, step.Description, step.Result, step.Duration, len(step.Attempts))
+		for _, attempt := range step.FailedAttempts() {
+			fmt.Printf("      attempt %d failed after %s: %s\n", attempt.Number, attempt.Duration.Round(time.Millisecond), attempt.Reason())
+		}
+		for _, name := range step.MetricNames() {
+			fmt.Printf("      %s: %g\n", name, step.Metrics[name])
+		}
+		for _, warning := range step.Warnings {
+			fmt.Printf("      warning: %s\n", warning)
+		}
 	}
 	fmt.Println()
 }
 
 func (report *SmokeTestReport) AfterSuiteDidRun(summary *types.SetupSummary) {
+	if summary.State == types.SpecStateFailed ||
+		summary.State == types.SpecStatePanicked ||
+		summary.State == types.SpecStateTimedOut {
+		report.teardownFailure = summary.Failure.Message
+	}
 	if ginkgo.GinkgoParallelNode() != 1 {
 		return
 	}
@@ -138,12 +285,23 @@ func (report *SmokeTestReport) AfterSuiteDidRun(summary *types.SetupSummary) {
 }
 
 func (report *SmokeTestReport) SpecSuiteDidEnd(summary *types.SuiteSummary) {
-	if ginkgo.GinkgoParallelNode() != 1 {
-		return
+	if report.JSONReportPath != "" {
+		if err := report.writeJSON(summary); err != nil {
+			fmt.Printf("\nSkipping \"Writing JSON report\": %s\n", err.Error())
+		}
+	}
+	if report.JUnitReportPath != "" {
+		if err := report.writeJUnit(); err != nil {
+			fmt.Printf("\nSkipping \"Writing JUnit report\": %s\n", err.Error())
+		}
 	}
-	matchJSON, err := regexp.Compile(`{"FailReason":\s"(.*)"}`)
-	if err != nil {
-		fmt.Printf("\nSkipping \"Summarising failure reasons\": %s\n", err.Error())
+	if report.Metrics.TextfilePath != "" || report.Metrics.PushgatewayURL != "" {
+		if err := report.exportMetrics(summary); err != nil {
+			fmt.Printf("\nSkipping \"Exporting metrics\": %s\n", err.Error())
+		}
+	}
+
+	if ginkgo.GinkgoParallelNode() != 1 {
 		return
 	}
 
@@ -153,13 +311,58 @@ func (report *SmokeTestReport) SpecSuiteDidEnd(summary *types.SuiteSummary) {
 		for _, failure := range report.failures {
 			fmt.Printf("\n%s\n", failure.title)
 
-			failMessage := matchJSON.FindStringSubmatch(failure.message)
-			if failMessage != nil {
-				fmt.Printf("> %s\n", failMessage[1])
+			if f := parseFailure(failure.message); f != nil {
+				printFailure(f)
 			}
 		}
-		fmt.Printf("\nFor help with troubleshooting, visit: https://docs.pivotal.io/redis/smoke-tests.html\n\n")
+		fmt.Printf("\nFor help with troubleshooting, visit: %s\n\n", failreason.DocsURL)
+	}
+}
+
+// parseFailure returns the Failure in a failure message, or nil if it has none
+func parseFailure(message string) *failreason.Failure {
+	if f, ok := failreason.Parse(message); ok {
+		return &f
+	}
+	return nil
+}
+
+// failReason returns the reason from a failure message, or "" if it has none
+func failReason(message string) string {
+	if f := parseFailure(message); f != nil {
+		return f.Reason
+	}
+	return ""
+}
+
+func printFailure(f *failreason.Failure) {
+	fmt.Printf("> %s\n", f.Reason)
+	if f.Code != "" {
+		fmt.Printf("  Code: %s\n", f.Code)
+	}
+	if len(f.Resources) > 0 {
+		resources := make([]string, len(f.Resources))
+		for i, resource := range f.Resources {
+			resources[i] = fmt.Sprintf("%s %q", resource.Kind, resource.Name)
+		}
+		fmt.Printf("  Resources: %s\n", strings.Join(resources, ", "))
+	}
+	if remediation := remediationFor(f); remediation != nil {
+		fmt.Print(indent(remediation.String(), "  "))
+	}
+	if f.DocsURL != "" && f.DocsURL != failreason.DocsURL {
+		fmt.Printf("  Docs: %s\n", f.DocsURL)
+	}
+}
+
+func indent(text, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
 	}
+	return strings.Join(lines, "")
 }
 
 func (report *SmokeTestReport) getTitleFromComponents(summary *types.SpecSummary) (title string) {
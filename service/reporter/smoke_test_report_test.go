@@ -0,0 +1,94 @@
+package reporter_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Step", func() {
+	var (
+		report *reporter.SmokeTestReport
+		policy retry.Policy
+	)
+
+	failTwice := func() retry.Operation {
+		calls := 0
+		return func(context.Context) (interface{}, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("not yet")
+			}
+			return nil, nil
+		}
+	}
+
+	BeforeEach(func() {
+		report = new(reporter.SmokeTestReport)
+		policy = retry.Policy{Backoff: retry.None(time.Millisecond), MaxRetries: 5}
+	})
+
+	It("records the attempts of operations observed by its report", func() {
+		policy.Observers = []retry.Observer{report.Observer()}
+		step := reporter.NewStep("Write a key", func() {
+			policy.Do(context.Background(), failTwice(), retry.NoError)
+		})
+		report.RegisterSpecSteps([]*reporter.Step{step})
+
+		step.Perform()
+
+		Expect(step.Attempts).To(HaveLen(3))
+		Expect(step.FailedAttempts()).To(HaveLen(2))
+	})
+
+	It("only records attempts made while it is performed", func() {
+		policy.Observers = []retry.Observer{report.Observer()}
+		first := reporter.NewStep("Write a key", func() {
+			policy.Do(context.Background(), failTwice(), retry.NoError)
+		})
+		second := reporter.NewStep("Read the key", func() {})
+		report.RegisterSpecSteps([]*reporter.Step{first, second})
+
+		first.Perform()
+		policy.Do(context.Background(), failTwice(), retry.NoError)
+		second.Perform()
+
+		Expect(first.Attempts).To(HaveLen(3))
+		Expect(second.Attempts).To(BeEmpty())
+	})
+
+	It("records the warning its check returns once the task has run", func() {
+		verified := false
+		step := reporter.NewStep("PING over TLS", func() { verified = true }).WithWarning(func() string {
+			if verified {
+				return ""
+			}
+			return "certificate chain was not verified"
+		})
+
+		step.Perform()
+		Expect(step.Warnings).To(BeEmpty())
+
+		verified = false
+		step.Task = func() {}
+		step.Perform()
+		Expect(step.Warnings).To(ConsistOf("certificate chain was not verified"))
+	})
+
+	It("does not record the attempts of operations its report does not observe", func() {
+		step := reporter.NewStep("Write a key", func() {
+			policy.Do(context.Background(), failTwice(), retry.NoError)
+		})
+		report.RegisterSpecSteps([]*reporter.Step{step})
+
+		step.Perform()
+
+		Expect(step.Attempts).To(BeEmpty())
+	})
+})
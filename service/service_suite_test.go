@@ -3,7 +3,10 @@ package service_test
 import (
 	"encoding/json"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,44 +15,245 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
 )
 
 type retryConfig struct {
-	BaselineMilliseconds uint   `json:"baseline_interval_milliseconds"`
-	Attempts             uint   `json:"max_attempts"`
-	BackoffAlgorithm     string `json:"backoff"`
+	BaselineMilliseconds    uint   `json:"baseline_interval_milliseconds"`
+	MinIntervalMilliseconds uint   `json:"min_interval_milliseconds"`
+	MaxIntervalMilliseconds uint   `json:"max_interval_milliseconds"`
+	Attempts                uint   `json:"max_attempts"`
+	BackoffAlgorithm        string `json:"backoff"`
+	Seed                    int64  `json:"seed"`
 }
 
+// defaultMaxIntervalBaselines is the default cap, in multiples of the
+// baseline, on the backoffs that would otherwise grow without bound:
+// "exponential", "full-jitter", "equal-jitter" and "decorrelated-jitter" sleep
+// for at most 10 baselines between attempts unless max_interval_milliseconds
+// is set. "linear" and the fixed default are not capped by default, as before.
+const defaultMaxIntervalBaselines = 10
+
 func (rc retryConfig) Backoff() retry.Backoff {
 	baseline := time.Duration(rc.BaselineMilliseconds) * time.Millisecond
 
 	algorithm := strings.ToLower(rc.BackoffAlgorithm)
 
+	var (
+		backoff retry.Backoff
+		grows   = true
+	)
 	switch algorithm {
 	case "linear":
-		return retry.Linear(baseline)
+		backoff = retry.Linear(baseline)
+		grows = false
 	case "exponential":
-		return retry.Linear(baseline)
+		backoff = retry.Exponential(baseline)
+	case "full-jitter":
+		backoff = retry.FullJitter(baseline, rc.random())
+	case "equal-jitter":
+		backoff = retry.EqualJitter(baseline, rc.random())
+	case "decorrelated-jitter":
+		backoff = retry.DecorrelatedJitter(baseline, rc.random())
 	default:
-		return retry.None(baseline)
+		backoff = retry.None(baseline)
+		grows = false
+	}
+
+	maxInterval := time.Duration(rc.MaxIntervalMilliseconds) * time.Millisecond
+	if maxInterval == 0 && grows {
+		maxInterval = defaultMaxIntervalBaselines * baseline
+	}
+
+	if rc.MinIntervalMilliseconds == 0 && maxInterval == 0 {
+		return backoff
 	}
+
+	return retry.Capped(backoff, time.Duration(rc.MinIntervalMilliseconds)*time.Millisecond, maxInterval)
+}
+
+// random is seeded lazily, once the parallel node is known, so that nodes
+// sharing a configured seed still back off out of step with each other
+func (rc retryConfig) random() retry.Random {
+	return &nodeRandom{seed: rc.Seed}
+}
+
+type nodeRandom struct {
+	once   sync.Once
+	seed   int64
+	random retry.Random
+}
+
+func (r *nodeRandom) Int63n(n int64) int64 {
+	r.once.Do(func() {
+		seed := r.seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		r.random = retry.NewRandom(seed + int64(GinkgoParallelNode()))
+	})
+	return r.random.Int63n(n)
 }
 
 func (rc retryConfig) MaxRetries() int {
 	return int(rc.Attempts)
 }
 
+type circuitBreakerConfig struct {
+	FailureThreshold int  `json:"failure_threshold"`
+	CoolDownSeconds  uint `json:"cool_down_seconds"`
+}
+
+// Breaker is nil, leaving the circuit breaker disabled, unless a failure threshold is configured
+func (cbc circuitBreakerConfig) Breaker() *retry.Breaker {
+	if cbc.FailureThreshold <= 0 {
+		return nil
+	}
+
+	return smokeTestCF.NewCloudControllerBreaker(cbc.FailureThreshold, time.Duration(cbc.CoolDownSeconds)*time.Second)
+}
+
+// persistenceConfig enables the persistence scenario, which writes Keys keys,
+// updates the instance with UpdateParameters and checks that the keys survive
+type persistenceConfig struct {
+	Keys              int             `json:"keys"`
+	UpdateParameters  json.RawMessage `json:"update_parameters"`
+	MinRecoveredRatio float64         `json:"min_recovered_ratio"`
+}
+
+// Parameters defaults to an empty update, which brokers still roll out to the instance
+func (pc persistenceConfig) Parameters() string {
+	if len(pc.UpdateParameters) == 0 {
+		return "{}"
+	}
+	return string(pc.UpdateParameters)
+}
+
+// MinRatio defaults to requiring every key to be recovered
+func (pc persistenceConfig) MinRatio() float64 {
+	if pc.MinRecoveredRatio == 0 {
+		return 1
+	}
+	return pc.MinRecoveredRatio
+}
+
+// memoryConfig is what a plan declares about its Redis memory settings. Empty
+// fields are not checked; MaxMemory takes redis.conf sizes such as "512mb".
+type memoryConfig struct {
+	MaxMemory       string `json:"maxmemory"`
+	MaxMemoryPolicy string `json:"maxmemory_policy"`
+	RedisVersion    string `json:"redis_version"`
+	FillToEvict     bool   `json:"fill_to_evict"`
+}
+
+func (mc memoryConfig) Enabled() bool {
+	return mc.MaxMemory != "" || mc.MaxMemoryPolicy != "" || mc.RedisVersion != ""
+}
+
+// benchmarkConfig enables the benchmark when Operations is set. Zero
+// thresholds are not checked.
+type benchmarkConfig struct {
+	Operations      int     `json:"operations"`
+	Concurrency     int     `json:"concurrency"`
+	ValueSize       int     `json:"value_size"`
+	MaxP50Millis    float64 `json:"max_p50_milliseconds"`
+	MaxP95Millis    float64 `json:"max_p95_milliseconds"`
+	MaxP99Millis    float64 `json:"max_p99_milliseconds"`
+	MinOpsPerSecond float64 `json:"min_ops_per_second"`
+}
+
+func (bc benchmarkConfig) Options() redis.BenchmarkOptions {
+	return redis.BenchmarkOptions{
+		Operations:  bc.Operations,
+		Concurrency: bc.Concurrency,
+		ValueSize:   bc.ValueSize,
+	}
+}
+
+func (bc benchmarkConfig) Thresholds() redis.BenchmarkThresholds {
+	millis := func(ms float64) time.Duration {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	return redis.BenchmarkThresholds{
+		P50:             millis(bc.MaxP50Millis),
+		P95:             millis(bc.MaxP95Millis),
+		P99:             millis(bc.MaxP99Millis),
+		MinOpsPerSecond: bc.MinOpsPerSecond,
+	}
+}
+
+// planConfig enables optional checks for a single plan
+type planConfig struct {
+	DataTypes        []string          `json:"data_types"`
+	DisabledCommands []string          `json:"disabled_commands"`
+	AllowedCommands  []string          `json:"allowed_commands"`
+	CheckIsolation   bool              `json:"check_isolation"`
+	Persistence      persistenceConfig `json:"persistence"`
+	Memory           memoryConfig      `json:"memory"`
+	Benchmark        benchmarkConfig   `json:"benchmark"`
+}
+
+// planUpgradeConfig is a plan change the broker is expected to allow
+type planUpgradeConfig struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// metricsConfig exports each run's results as Prometheus metrics, to a
+// textfile collector file, a Pushgateway, or both
+type metricsConfig struct {
+	TextfilePath   string `json:"textfile_path"`
+	PushgatewayURL string `json:"pushgateway_url"`
+	Job            string `json:"job"`
+}
+
+func (mc metricsConfig) Exporter() reporter.MetricsExporter {
+	return reporter.MetricsExporter{
+		TextfilePath:   mc.TextfilePath,
+		PushgatewayURL: mc.PushgatewayURL,
+		Job:            mc.Job,
+	}
+}
+
 type redisTestConfig struct {
 	config.Config
 
-	ServiceName string      `json:"service_name"`
-	PlanNames   []string    `json:"plan_names"`
-	Retry       retryConfig `json:"retry"`
-	TLSEnabled  bool        `json:"tls_enabled"`
-	TLSVersions []string    `json:"tls_versions"`
-	UseHttpApp  bool    	 `json:"use_http_app_smoke_tests"`
+	ServiceName  string                `json:"service_name"`
+	PlanNames    []string              `json:"plan_names"`
+	Plans        map[string]planConfig `json:"plans"`
+	PlanUpgrades []planUpgradeConfig   `json:"plan_upgrades"`
+	Retry        retryConfig           `json:"retry"`
+	Breaker      circuitBreakerConfig  `json:"circuit_breaker"`
+	TLSEnabled   bool                  `json:"tls_enabled"`
+	TLSVersions  []string              `json:"tls_versions"`
+	UseHttpApp   bool                  `json:"use_http_app_smoke_tests"`
+	UseCCAPI     bool                  `json:"use_cc_api"`
+	JUnitReport  bool                  `json:"junit_report"`
+	Metrics      metricsConfig         `json:"metrics"`
+
+	AsyncPollIntervalSeconds uint `json:"async_service_operation_poll_interval_seconds"`
+}
+
+// AsyncPollInterval is zero, leaving the cf helpers' default, unless configured
+func (rtc redisTestConfig) AsyncPollInterval() time.Duration {
+	return time.Duration(rtc.AsyncPollIntervalSeconds) * time.Second
+}
+
+// CloudController is nil, leaving the cf helpers to drive the cf CLI, unless
+// use_cc_api is set. Even then the CLI is still needed for suite setup,
+// quotas, orgs, spaces, users and logging out; see the README.
+func (rtc redisTestConfig) CloudController() smokeTestCF.CloudController {
+	if !rtc.UseCCAPI {
+		return nil
+	}
+
+	return ccv3.NewClient(rtc.ApiEndpoint, rtc.SkipSSLValidation)
 }
 
 func loadRedisTestConfig(path string) redisTestConfig {
@@ -76,19 +280,31 @@ var (
 
 	redisConfig = loadRedisTestConfig(configPath)
 
-	smokeTestReporter *reporter.SmokeTestReport
+	// smokeTestReporter is created with the package, since the spec tree
+	// registers plan contexts with it as it is built
+	smokeTestReporter = new(reporter.SmokeTestReport)
 
 	wfh *workflowhelpers.ReproducibleTestSuiteSetup
 )
 
 func TestService(t *testing.T) {
-	smokeTestReporter = new(reporter.SmokeTestReport)
+	smokeTestReporter.Metrics = redisConfig.Metrics.Exporter()
+	if redisConfig.ArtifactsDirectory != "" {
+		smokeTestReporter.JSONReportPath = filepath.Join(redisConfig.ArtifactsDirectory, "smoke-test-report.json")
+		if redisConfig.JUnitReport {
+			smokeTestReporter.JUnitReportPath = filepath.Join(redisConfig.ArtifactsDirectory, "junit-smoke-tests.xml")
+		}
+	}
 
 	testReporter := []Reporter{
 		Reporter(smokeTestReporter),
 	}
 
 	BeforeSuite(func() {
+		// use_cc_api does not cover suite setup, quotas, users or service
+		// access, which still drive the cf CLI
+		_, err := exec.LookPath("cf")
+		Expect(err).NotTo(HaveOccurred(), failreason.New(failreason.InvalidConfig, "The cf CLI must be on the PATH, even with use_cc_api set").String())
 
 		wfh = workflowhelpers.NewTestSuiteSetup(&redisConfig.Config)
 
@@ -105,7 +321,6 @@ func TestService(t *testing.T) {
 			task.Perform()
 		}
 
-
 	})
 
 	AfterSuite(func() {
@@ -126,4 +341,3 @@ func TestService(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecsWithDefaultAndCustomReporters(t, "P-Redis Smoke Tests", testReporter)
 }
-
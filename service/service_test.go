@@ -6,12 +6,14 @@ import (
 	"time"
 
 	"github.com/pborman/uuid"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/failreason"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
 
 	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Redis On-Demand", func() {
@@ -21,6 +23,12 @@ var _ = Describe("Redis On-Demand", func() {
 			LongTimeout:  time.Minute * 15,
 			RetryBackoff: redisConfig.Retry.Backoff(),
 			MaxRetries:   redisConfig.Retry.MaxRetries(),
+			Breaker:      redisConfig.Breaker.Breaker(),
+			CC:           redisConfig.CloudController(),
+			Observer:     smokeTestReporter.Observer(),
+
+			AsyncOperationTimeout: redisConfig.AsyncServiceOperationTimeoutDuration(),
+			AsyncPollInterval:     redisConfig.AsyncPollInterval(),
 		}
 
 		retryInterval = time.Second
@@ -28,24 +36,54 @@ var _ = Describe("Redis On-Demand", func() {
 		appPath             = "../assets/cf-redis-example-app"
 		serviceInstanceName string
 		appName             string
-		planName            string
+		instancePlanName    string
 		securityGroupName   string
 		serviceKeyName      string
 		serviceKey          smokeTestCF.Credentials
 
-		CreateTlsSpecStep = func(app *redis.App, version string, key string, value string) *reporter.Step {
-			tlsMessage := strings.ToUpper(version) + " clients are disabled"
-			valueCheck := "protocol not supported"
-			if hasTLSVersion(serviceKey, version) {
-				tlsMessage = strings.ToUpper(version) + " clients are enabled"
-				valueCheck = value
-			}
-			return reporter.NewStep(tlsMessage, app.ReadTLSAssert(version, key, valueCheck))
+		otherServiceInstanceName string
+		otherServiceKeyName      string
+		otherServiceKey          smokeTestCF.Credentials
+
+		// AssertSecondInstanceTeardown names a second instance and service key
+		// for each spec and deletes them once it has run, whether or not the
+		// spec got as far as creating them
+		AssertSecondInstanceTeardown = func(planName string) {
+			BeforeEach(func() {
+				otherServiceInstanceName = randomName()
+				otherServiceKeyName = randomName()
+			})
+
+			AfterEach(func() {
+				specSteps := []*reporter.Step{
+					reporter.NewStep(
+						fmt.Sprintf("Delete the service key %s for the second instance", otherServiceKeyName),
+						testCF.DeleteServiceKey(otherServiceInstanceName, otherServiceKeyName),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Delete the second %q plan instance", planName),
+						testCF.DeleteService(otherServiceInstanceName),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Ensure the second service instance for plan %q has been deleted", planName),
+						testCF.EnsureServiceInstanceGone(otherServiceInstanceName),
+					),
+				}
+
+				smokeTestReporter.RegisterSpecSteps(specSteps)
+				performSteps(specSteps)
+			})
 		}
 
 		AssertLifeCycleBehavior = func(planName string) {
+			BeforeEach(func() {
+				instancePlanName = planName
+			})
+
+			AssertSecondInstanceTeardown(planName)
+
 			It("creates, binds to, writes to, reads from, unbinds, and destroys", func() {
-				var skip bool
+				var skip, otherSkip bool
 
 				uri := fmt.Sprintf("https://%s.%s", appName, redisConfig.Config.AppsDomain)
 
@@ -53,7 +91,9 @@ var _ = Describe("Redis On-Demand", func() {
 					uri = fmt.Sprintf("http://%s.%s", appName, redisConfig.Config.AppsDomain)
 				}
 
-				app := redis.NewApp(uri, testCF.ShortTimeout, retryInterval)
+				app := redis.NewApp(uri, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
+				client := redis.NewClient(&serviceKey, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
+				otherClient := redis.NewClient(&otherServiceKey, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
 
 				enableServiceAccessStep := reporter.NewStep(
 					fmt.Sprintf("Enable service plan access for '%s' org", wfh.GetOrganizationName()),
@@ -103,6 +143,108 @@ var _ = Describe("Redis On-Demand", func() {
 						"Read the key/value pair back",
 						app.ReadAssert("mykey", "myvalue"),
 					),
+					reporter.NewStep(
+						"Direct: PING the instance using the service key",
+						client.Ping(),
+					),
+					reporter.NewStep(
+						"Direct: Verify the instance refuses no password and a random password, and accepts the service key password",
+						client.AssertRequiresPassword(),
+					),
+					reporter.NewStep(
+						"Direct: Read the app's key/value pair",
+						client.ReadAssert("mykey", "myvalue"),
+					),
+					reporter.NewStep(
+						"Direct: Write a key/value pair to Redis",
+						client.Write("directkey", "directvalue"),
+					),
+					reporter.NewStep(
+						"Direct: Read the key/value pair back",
+						client.ReadAssert("directkey", "directvalue"),
+					),
+					reporter.NewStep(
+						"Direct: Delete the key",
+						client.Delete("directkey"),
+					),
+				}
+
+				plan := redisConfig.Plans[planName]
+
+				if len(plan.DisabledCommands) > 0 {
+					specSteps = append(specSteps, reporter.NewStep(
+						fmt.Sprintf("Direct: Verify the '%s' plan rejects %s", planName, strings.Join(plan.DisabledCommands, ", ")),
+						client.AssertCommandsDisabled(plan.DisabledCommands...),
+					))
+				}
+				if len(plan.AllowedCommands) > 0 {
+					specSteps = append(specSteps, reporter.NewStep(
+						fmt.Sprintf("Direct: Verify the '%s' plan permits %s", planName, strings.Join(plan.AllowedCommands, ", ")),
+						client.AssertCommandsAllowed(plan.AllowedCommands...),
+					))
+				}
+
+				for _, dataType := range plan.DataTypes {
+					check, err := client.DataType(dataType, "smoke-"+dataType)
+					Expect(err).NotTo(HaveOccurred(), failreason.New(failreason.InvalidConfig, "Invalid data_types configuration").With("plan", planName).String())
+
+					specSteps = append(specSteps, reporter.NewStep(
+						fmt.Sprintf("Direct: Verify Redis %s", strings.Replace(dataType, "_", " ", -1)),
+						check,
+					))
+				}
+
+				if plan.Memory.Enabled() {
+					var maxMemory int64
+					if plan.Memory.MaxMemory != "" {
+						var err error
+						maxMemory, err = redis.ParseMemory(plan.Memory.MaxMemory)
+						Expect(err).NotTo(HaveOccurred(), failreason.New(failreason.InvalidConfig, "Invalid memory configuration").With("plan", planName).String())
+					}
+
+					specSteps = append(specSteps, reporter.NewStep(
+						fmt.Sprintf("Direct: Verify the '%s' plan memory configuration", planName),
+						client.AssertMemoryConfig(maxMemory, plan.Memory.MaxMemoryPolicy, plan.Memory.RedisVersion),
+					))
+				}
+				if plan.Memory.FillToEvict {
+					specSteps = append(specSteps, reporter.NewStep(
+						"Direct: Fill the instance and verify its eviction policy",
+						client.AssertEviction(),
+					))
+				}
+
+				var (
+					recovered float64
+					benchmark redis.BenchmarkResult
+				)
+
+				if keys := plan.Persistence.Keys; keys > 0 {
+					specSteps = append(specSteps,
+						reporter.NewStep(
+							fmt.Sprintf("Direct: Write %d keys for the persistence check", keys),
+							client.WriteDataset("persistence", keys),
+						),
+						reporter.NewStep(
+							fmt.Sprintf("Update the '%s' plan instance '%s' of Redis", planName, serviceInstanceName),
+							testCF.UpdateServiceParameters(serviceInstanceName, plan.Persistence.Parameters()),
+						),
+						reporter.NewStep(
+							"Direct: Verify the keys survived the update",
+							client.AssertDataset("persistence", keys, plan.Persistence.MinRatio(), &recovered),
+						).WithMetrics(func() map[string]float64 {
+							return map[string]float64{"recovered_ratio": recovered}
+						}),
+					)
+				}
+
+				if plan.Benchmark.Operations > 0 {
+					specSteps = append(specSteps, reporter.NewStep(
+						fmt.Sprintf("Direct: Benchmark %d GET/SET operations", plan.Benchmark.Operations),
+						client.Benchmark(plan.Benchmark.Options(), plan.Benchmark.Thresholds(), &benchmark),
+					).WithMetrics(func() map[string]float64 {
+						return benchmark.Metrics()
+					}))
 				}
 
 				smokeTestReporter.RegisterSpecSteps(specSteps)
@@ -124,25 +266,275 @@ var _ = Describe("Redis On-Demand", func() {
 							"TLS: Read the key/value pair back",
 							app.ReadAssert("mykey", "myvalue2"),
 						),
-						CreateTlsSpecStep(app, "tlsv1", "mykey", "myvalue2"),
-						CreateTlsSpecStep(app, "tlsv1.1", "mykey", "myvalue2"),
-						CreateTlsSpecStep(app, "tlsv1.2", "mykey", "myvalue2"),
+						reporter.NewStep(
+							"TLS: Negotiated protocol versions match the service key",
+							client.AssertTLSVersions(),
+						).WithWarning(client.TLSWarning),
+						reporter.NewStep(
+							"Direct TLS: PING the instance on the TLS port",
+							client.TLS().Ping(),
+						).WithWarning(client.TLSWarning),
+						reporter.NewStep(
+							"Direct TLS: Read the key/value pair back",
+							client.TLS().ReadAssert("mykey", "myvalue2"),
+						).WithWarning(client.TLSWarning),
 					}
 					smokeTestReporter.RegisterSpecSteps(tlsSpecSteps)
 					performSteps(tlsSpecSteps)
 				}
+
+				if !skip {
+					otherServiceCreateStep := reporter.NewStep(
+						fmt.Sprintf("Create a second '%s' plan instance of Redis for the password check", planName),
+						testCF.CreateService(redisConfig.ServiceName, planName, otherServiceInstanceName, &otherSkip),
+					)
+					passwordSpecSteps := []*reporter.Step{
+						reporter.NewStep(
+							"Create a service key for the second instance",
+							testCF.CreateServiceKey(otherServiceInstanceName, otherServiceKeyName),
+						),
+						reporter.NewStep(
+							"Read the second instance's service key",
+							testCF.GetServiceKey(otherServiceInstanceName, &otherServiceKey),
+						),
+						reporter.NewStep(
+							"Direct: Verify the instance refuses the second instance's password",
+							client.AssertRejectsPassword(&otherServiceKey),
+						),
+						reporter.NewStep(
+							"Direct: Verify the second instance refuses the instance's password",
+							otherClient.AssertRejectsPassword(&serviceKey),
+						),
+					}
+					smokeTestReporter.RegisterSpecSteps(append([]*reporter.Step{otherServiceCreateStep}, passwordSpecSteps...))
+
+					otherServiceCreateStep.Perform()
+					if otherSkip {
+						otherServiceCreateStep.Result = "SKIPPED"
+					} else {
+						performSteps(passwordSpecSteps)
+					}
+				}
+			})
+		}
+
+		AssertIsolationBehavior = func(planName string) {
+			BeforeEach(func() {
+				instancePlanName = planName
+			})
+
+			AssertSecondInstanceTeardown(planName)
+
+			It("keeps the keys of two instances apart", func() {
+				var skip, otherSkip bool
+
+				uri := fmt.Sprintf("https://%s.%s", appName, redisConfig.Config.AppsDomain)
+
+				if redisConfig.UseHttpApp {
+					uri = fmt.Sprintf("http://%s.%s", appName, redisConfig.Config.AppsDomain)
+				}
+
+				app := redis.NewApp(uri, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
+				client := redis.NewClient(&serviceKey, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
+				otherClient := redis.NewClient(&otherServiceKey, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
+
+				serviceCreateSteps := []*reporter.Step{
+					reporter.NewStep(
+						fmt.Sprintf("Enable service plan access for '%s' org", wfh.GetOrganizationName()),
+						testCF.EnableServiceAccessForPlan(wfh.GetOrganizationName(), redisConfig.ServiceName, planName),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Create a '%s' plan instance of Redis", planName),
+						testCF.CreateService(redisConfig.ServiceName, planName, serviceInstanceName, &skip),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Create a second '%s' plan instance of Redis", planName),
+						testCF.CreateService(redisConfig.ServiceName, planName, otherServiceInstanceName, &otherSkip),
+					),
+				}
+
+				smokeTestReporter.RegisterSpecSteps(serviceCreateSteps)
+				performSteps(serviceCreateSteps)
+
+				specSteps := []*reporter.Step{
+					reporter.NewStep(
+						fmt.Sprintf("Bind the redis sample app '%s' to the first instance '%s'", appName, serviceInstanceName),
+						testCF.BindService(appName, serviceInstanceName),
+					),
+					reporter.NewStep(
+						"Create a service key for the first instance",
+						testCF.CreateServiceKey(serviceInstanceName, serviceKeyName),
+					),
+					reporter.NewStep(
+						"Read the first instance's service key",
+						testCF.GetServiceKey(serviceInstanceName, &serviceKey),
+					),
+					reporter.NewStep(
+						"Create a service key for the second instance",
+						testCF.CreateServiceKey(otherServiceInstanceName, otherServiceKeyName),
+					),
+					reporter.NewStep(
+						"Read the second instance's service key",
+						testCF.GetServiceKey(otherServiceInstanceName, &otherServiceKey),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Create and bind security group '%s' for running smoke tests", securityGroupName),
+						testCF.CreateAndBindSecurityGroup(securityGroupName, serviceInstanceName, wfh.GetOrganizationName(), wfh.TestSpace.SpaceName()),
+					),
+					reporter.NewStep(
+						"Start the app",
+						testCF.Start(appName),
+					),
+					reporter.NewStep(
+						"Verify that the app is responding",
+						app.IsRunning(),
+					),
+					reporter.NewStep(
+						"Write a key to the first instance through the app",
+						app.Write("isolation-first", "first"),
+					),
+					reporter.NewStep(
+						"Direct: Read the key back from the first instance",
+						client.ReadAssert("isolation-first", "first"),
+					),
+					reporter.NewStep(
+						"Direct: Verify the key is absent from the second instance",
+						otherClient.AssertAbsent("isolation-first"),
+					),
+					reporter.NewStep(
+						"Direct: Write a key to the second instance",
+						otherClient.Write("isolation-second", "second"),
+					),
+					reporter.NewStep(
+						"Verify the second instance's key is absent through the app",
+						app.ReadAbsentAssert("isolation-second"),
+					),
+					reporter.NewStep(
+						"Direct: Verify the second instance's key is absent from the first instance",
+						client.AssertAbsent("isolation-second"),
+					),
+					reporter.NewStep(
+						"Direct: Verify the first instance refuses the second instance's password",
+						client.AssertRejectsPassword(&otherServiceKey),
+					),
+					reporter.NewStep(
+						"Direct: Verify the second instance refuses the first instance's password",
+						otherClient.AssertRejectsPassword(&serviceKey),
+					),
+				}
+
+				smokeTestReporter.RegisterSpecSteps(specSteps)
+
+				if skip {
+					serviceCreateSteps[1].Result = "SKIPPED"
+				}
+				if otherSkip {
+					serviceCreateSteps[2].Result = "SKIPPED"
+				}
+				if !skip && !otherSkip {
+					performSteps(specSteps)
+				}
+			})
+		}
+
+		AssertPlanUpgradeBehavior = func(upgrade planUpgradeConfig) {
+			BeforeEach(func() {
+				instancePlanName = upgrade.From
+			})
+
+			It("upgrades the plan and keeps the data", func() {
+				var (
+					skip      bool
+					recovered float64
+				)
+
+				client := redis.NewClient(&serviceKey, testCF.ShortTimeout, retryInterval).WithObserver(smokeTestReporter.Observer())
+
+				serviceCreateSteps := []*reporter.Step{
+					reporter.NewStep(
+						fmt.Sprintf("Enable service plan access to '%s' for '%s' org", upgrade.From, wfh.GetOrganizationName()),
+						testCF.EnableServiceAccessForPlan(wfh.GetOrganizationName(), redisConfig.ServiceName, upgrade.From),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Enable service plan access to '%s' for '%s' org", upgrade.To, wfh.GetOrganizationName()),
+						testCF.EnableServiceAccessForPlan(wfh.GetOrganizationName(), redisConfig.ServiceName, upgrade.To),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Create a '%s' plan instance of Redis", upgrade.From),
+						testCF.CreateService(redisConfig.ServiceName, upgrade.From, serviceInstanceName, &skip),
+					),
+				}
+
+				smokeTestReporter.RegisterSpecSteps(serviceCreateSteps)
+				performSteps(serviceCreateSteps)
+
+				specSteps := []*reporter.Step{
+					reporter.NewStep(
+						fmt.Sprintf("Create service key for the '%s' plan instance '%s' of Redis", upgrade.From, serviceInstanceName),
+						testCF.CreateServiceKey(serviceInstanceName, serviceKeyName),
+					),
+					reporter.NewStep(
+						"Read the Service Key",
+						testCF.GetServiceKey(serviceInstanceName, &serviceKey),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Direct: Write keys to the '%s' plan instance", upgrade.From),
+						client.WriteDataset("upgrade", 100),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Upgrade the instance from the '%s' plan to the '%s' plan", upgrade.From, upgrade.To),
+						testCF.UpdateService(redisConfig.ServiceName, upgrade.To, serviceInstanceName),
+					),
+					reporter.NewStep(
+						"Read the Service Key after the upgrade",
+						testCF.GetServiceKey(serviceInstanceName, &serviceKey),
+					),
+					reporter.NewStep(
+						fmt.Sprintf("Direct: Verify the keys survived the upgrade to the '%s' plan", upgrade.To),
+						client.AssertDataset("upgrade", 100, 1, &recovered),
+					).WithMetrics(func() map[string]float64 {
+						return map[string]float64{"recovered_ratio": recovered}
+					}),
+				}
+
+				smokeTestReporter.RegisterSpecSteps(specSteps)
+
+				if skip {
+					serviceCreateSteps[2].Result = "SKIPPED"
+				} else {
+					performSteps(specSteps)
+				}
 			})
 		}
 	)
 
 	Context("service instance", func() {
 		Context("life-cycle", func() {
-			for _, planName = range redisConfig.PlanNames {
-				Context("for "+strings.ToUpper(planName)+" plans:", func() {
+			for _, planName := range redisConfig.PlanNames {
+				Context(smokeTestReporter.PlanContext("for "+strings.ToUpper(planName)+" plans:", planName), func() {
 					AssertLifeCycleBehavior(planName)
 				})
 			}
 		})
+
+		Context("plan upgrades", func() {
+			for _, upgrade := range redisConfig.PlanUpgrades {
+				Context(smokeTestReporter.PlanContext("from "+strings.ToUpper(upgrade.From)+" to "+strings.ToUpper(upgrade.To)+" plans:", upgrade.From, upgrade.To), func() {
+					AssertPlanUpgradeBehavior(upgrade)
+				})
+			}
+		})
+
+		Context("isolation", func() {
+			for _, planName := range redisConfig.PlanNames {
+				if redisConfig.Plans[planName].CheckIsolation {
+					Context(smokeTestReporter.PlanContext("for "+strings.ToUpper(planName)+" plans:", planName), func() {
+						AssertIsolationBehavior(planName)
+					})
+				}
+			}
+		})
+
 		BeforeEach(func() {
 			appName = randomName()
 			serviceInstanceName = randomName()
@@ -196,7 +588,7 @@ var _ = Describe("Redis On-Demand", func() {
 		AfterEach(func() {
 			specSteps := []*reporter.Step{
 				reporter.NewStep(
-					fmt.Sprintf("Unbind the %q plan instance", planName),
+					fmt.Sprintf("Unbind the %q plan instance", instancePlanName),
 					testCF.UnbindService(appName, serviceInstanceName),
 				),
 				reporter.NewStep(
@@ -204,15 +596,15 @@ var _ = Describe("Redis On-Demand", func() {
 					testCF.DeleteSecurityGroup(securityGroupName),
 				),
 				reporter.NewStep(
-					fmt.Sprintf("Delete the service key %s for the %q plan instance", serviceKeyName, planName),
+					fmt.Sprintf("Delete the service key %s for the %q plan instance", serviceKeyName, instancePlanName),
 					testCF.DeleteServiceKey(serviceInstanceName, serviceKeyName),
 				),
 				reporter.NewStep(
-					fmt.Sprintf("Delete the %q plan instance", planName),
+					fmt.Sprintf("Delete the %q plan instance", instancePlanName),
 					testCF.DeleteService(serviceInstanceName),
 				),
 				reporter.NewStep(
-					fmt.Sprintf("Ensure service instance for plan %q has been deleted", planName),
+					fmt.Sprintf("Ensure service instance for plan %q has been deleted", instancePlanName),
 					testCF.EnsureServiceInstanceGone(serviceInstanceName),
 				),
 				reporter.NewStep(
@@ -231,15 +623,6 @@ func randomName() string {
 	return uuid.NewRandom().String()
 }
 
-func hasTLSVersion(serviceKey smokeTestCF.Credentials, version string) bool {
-	for _, v := range serviceKey.TLS_Versions {
-		if version == v {
-			return true
-		}
-	}
-	return false
-}
-
 func tlsEnabled(serviceKey smokeTestCF.Credentials) bool {
 	return (serviceKey.TLS_Port > 0)
 }